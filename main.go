@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
 	emp "didTest/pkg"
-	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/crypto"
 	"github.com/TBD54566975/ssi-sdk/did"
 	"github.com/TBD54566975/ssi-sdk/did/key"
 	"github.com/TBD54566975/ssi-sdk/did/peer"
@@ -37,270 +43,880 @@ func init() {
 	}
 }
 
-// main runs two the authentication interaction in two cases :
-//case 1 - single VC with 20 groups and case 2- Linked VC
-func main() {
-	
-	// Case 1 : Using one VC with all the information
-	// Univeristy Issues 1 Credentials (containing Univeristy Name and the 20 groups user is part of)
-	// Case 2 : Using Linked VC Model
-	// Univeristy Issues 2 Credentials (one with Idenitity VC and one with MembershipVC)
-	var t1, t2, t3, t4 time.Duration
-	var size1, size2, size3, psize1, psize2 int
-	example.WriteNote("------------Case1")
-	{
-		step := 0
-
-		example.WriteStep("Starting University Flow", step)
-		step++
-		start := time.Now()
-
-		// Wallet initialization
-		example.WriteStep("Initializing Student", step)
-		step++
-
-		student, err := emp.NewEntity("Student", did.KeyMethod)
-		example.HandleExampleError(err, "failed to create student")
-		studentDID := student.GetWallet().GetDIDs()[0]
-		studentKeys, err := student.GetWallet().GetKeysForDID(studentDID)
-		studentKey := studentKeys[0].Key
-		studentKID := studentKeys[0].ID
-		example.HandleExampleError(err, "failed to get student key")
-
-		example.WriteStep("Initializing Employer", step)
-		step++
-
-		employer, err := emp.NewEntity("Employer", "peer")
-		example.HandleExampleError(err, "failed to make employer identity")
-		employerDID := employer.GetWallet().GetDIDs()[0]
-		employerKeys, err := employer.GetWallet().GetKeysForDID(employerDID)
-		employerKey := employerKeys[0].Key
-		employerKID := employerKeys[0].ID
-		example.HandleExampleError(err, "failed to get employer key")
-
-		example.WriteStep("Initializing University", step)
-		step++
-
-		university, err := emp.NewEntity("University", did.PeerMethod)
-		example.HandleExampleError(err, "failed to create university")
-		universityDID := university.GetWallet().GetDIDs()[0]
-		universityKeys, err := university.GetWallet().GetKeysForDID(universityDID)
-		universityKey := universityKeys[0].Key
-		universityKID := universityKeys[0].ID
-		example.HandleExampleError(err, "failed to get university key")
-
-		example.WriteNote(fmt.Sprintf("Initialized University (Verifier) DID: %s and registered it", universityDID))
+var (
+	groupCount = flag.Int("groups", emp.DefaultGroupCount, "number of groups the student is part of")
+	sweep      = flag.String("sweep", "", "comma separated group counts to benchmark, e.g. 1,10,100,1000")
+	csvFile    = flag.String("out", "", "file the sweep CSV is written to; defaults to standard output, which the cases narrate to as well")
+	revoke     = flag.Bool("revoke", false, "revoke the Teaching Assistant membership VC before the employer checks it (case 2)")
+	rotate     = flag.Bool("rotate", false, "rotate the university's signing key after it issued the VCs, before the employer checks them (case 2)")
+	policyFile = flag.String("policy", "", "JSON or YAML access policy the employer enforces; defaults to a Teaching Assistant from the university")
+	replay     = flag.Bool("replay", false, "send the student's submission to the employer a second time, which must be rejected")
+	issuerFile = flag.String("issuers", "", "JSON or YAML trusted issuer registry of the employer; defaults to trusting the university")
+	defFile    = flag.String("definition", "", "JSON presentation definition the employer sends in case 2; defaults to the identity VC and a Teaching Assistant membership from the university")
+	keyTypes   = flag.String("keytypes", string(crypto.Ed25519), "comma separated key types of the entities' DIDs to run the cases with, e.g. Ed25519,P-256,P-384,RSA")
+	webDID     = flag.Bool("didweb", false, "give the university a did:web DID whose document a local server hosts, instead of a did:peer DID")
+	walletDir  = flag.String("wallets", "", "directory keeping the wallets and keys of the case 1 entities between runs, encrypted with the passphrase in "+walletPassphraseEnv)
+)
 
-		example.WriteStep("Example University Creates VC for Holder", step)
-		step++
+// walletPassphraseEnv is the environment variable holding the passphrase of the -wallets files
+const walletPassphraseEnv = "WALLET_PASSPHRASE"
+
+// caseResult holds the measurements of one run of a case
+type caseResult struct {
+	model            string
+	keyType          crypto.KeyType
+	groups           int
+	vcCount          int
+	vcSize           int // total size of all VCs issued to the student
+	presentationSize int
+	verifyTime       time.Duration
+	totalTime        time.Duration
+}
 
-		universitySigner, err := jwx.NewJWXSigner(universityDID, universityKID, universityKey)
-		example.HandleExampleError(err, "failed to build university signer")
+// main runs two the authentication interaction in six cases :
+// case 1 - single VC with N groups, case 2- Linked VC, case 3 - single SD-JWT VC disclosing only the TA role,
+// case 4 - single BBS credential from which a proof revealing only the TA role is derived,
+// case 5 - single VC with a Merkle root over the groups and a membership proof of the TA role
+// and case 6 - case 1 with a JSON-LD VC and VP signed with Data Integrity proofs instead of JWTs
+// With -sweep all cases are run once per group count and the results are written as CSV to -out; with -keytypes
+// they are run once per key type as well, so the algorithms can be compared
+func main() {
+	flag.Parse()
+
+	counts := []int{*groupCount}
+	if *sweep != "" {
+		counts = nil
+		for _, c := range strings.Split(*sweep, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(c))
+			example.HandleExampleError(err, "failed to parse sweep")
+			counts = append(counts, n)
+		}
+	}
 
-		vcID, vc, err := emp.BuildSingleVC(*universitySigner, universityDID, studentDID)
-		example.HandleExampleError(err, "failed to build vc")
+	if *webDID && *walletDir != "" {
+		// the local server gets another port, and so the university another DID, on every run
+		example.HandleExampleError(fmt.Errorf("-didweb cannot be used with -wallets"), "invalid flags")
+	}
 
-		example.WriteStep("Example University Sends VC to Student (Holder)", step)
-		step++
-        size1 = len(vc)   
-		err = student.GetWallet().AddCredentialJWT(vcID, vc)
-		example.HandleExampleError(err, "failed to add credentials to wallet")
+	// the CSV file is made before the cases run, so a bad path does not waste a sweep
+	csvOut := os.Stdout
+	if *sweep != "" && *csvFile != "" {
+		f, err := os.Create(*csvFile)
+		example.HandleExampleError(err, "failed to create CSV file")
+		defer f.Close()
+		csvOut = f
+	}
 
-		msg := fmt.Sprintf("VC is stored in wallet. Wallet size is now: %d", student.GetWallet().Size())
-		example.WriteNote(msg)
+	var kts []crypto.KeyType
+	for _, kt := range strings.Split(*keyTypes, ",") {
+		kts = append(kts, crypto.KeyType(strings.TrimSpace(kt)))
+	}
 
-		example.WriteNote(fmt.Sprintf("initialized Employer (Verifier) DID: %v", employerDID))
-		example.WriteStep("Verifier wants to verify student role as TA. Sends a presentation request", step)
-		step++
+	var results []caseResult
+	for _, kt := range kts {
+		results = append(results, runCases(counts, kt)...)
+	}
 
-		presentationData, err := emp.MakePresentationData("test-id", "id-1", universityDID)
-		example.HandleExampleError(err, "failed to create pd")
+	if *sweep != "" {
+		err := printCSV(csvOut, results)
+		example.HandleExampleError(err, "failed to write CSV")
+		return
+	}
+	printSummary(results)
+}
 
-		dat, err := json.Marshal(presentationData)
-		example.HandleExampleError(err, "failed to marshal presentation data")
-		logrus.Debugf("Presentation Data:\n%v", string(dat))
-
-		presentationRequestJWT, employerSigner, err := emp.MakePresentationRequest(employerKey, employerKID, presentationData, employerDID, studentDID)
-		example.HandleExampleError(err, "failed to make presentation request")
-
-		studentSigner, err := jwx.NewJWXSigner(studentDID, studentKID, studentKey)
-		example.HandleExampleError(err, "failed to build json web key signer")
-
-		example.WriteNote("Student returns claims via a Presentation Submission")
-
-		employerVerifier, err := employerSigner.ToVerifier(studentDID)
-		example.HandleExampleError(err, "failed to build employer verifier")
-		submission, err := emp.BuildPresentationSubmission(string(presentationRequestJWT), *employerVerifier, *studentSigner, vc)
-		example.HandleExampleError(err, "failed to build presentation submission")
-
-		verifier, err := studentSigner.ToVerifier(employerDID)
-		example.HandleExampleError(err, "failed to construct verifier")
-
-		r, err := resolution.NewResolver([]resolution.Resolver{key.Resolver{}, peer.Resolver{}}...)
-		example.HandleExampleError(err, "failed to create DID r")
-		_, _, vp, err := credential.VerifyVerifiablePresentationJWT(context.Background(), *verifier, r, string(submission))
-		example.HandleExampleError(err, "failed to verify jwt")
-
-		dat, err = json.Marshal(vp)
-		psize1 = len(dat)
-		example.HandleExampleError(err, "failed to marshal submission")
-		tokenSize := len(dat)
-		logrus.Debugf("Submission:\n%v", string(dat))
-		logrus.Debugf("lenght:\n%v", tokenSize)
-		startverify := time.Now()
-		example.WriteStep("Employer Attempting to Grant Access", step)
-		if err = emp.ValidateAccess(*verifier, r, submission); err == nil {
-			example.WriteOK("Access Granted!")
-		} else {
-			example.WriteError(fmt.Sprintf("Access was not granted! Reason: %s", err))
+// runCases runs every case once per group count with entities whose DIDs have keys of type kt
+func runCases(counts []int, kt crypto.KeyType) []caseResult {
+	var results []caseResult
+	for _, n := range counts {
+		groups, err := emp.GenerateGroups(n)
+		example.HandleExampleError(err, "failed to generate groups")
+		example.WriteNote(fmt.Sprintf("------------%d groups with %s keys", n, kt))
+
+		// Case 1 : Using one VC with all the information
+		// Univeristy Issues 1 Credentials (containing Univeristy Name and the N groups user is part of)
+		example.WriteNote("------------Case1")
+		results = append(results, runSingleVC(groups, kt))
+
+		// Case 2 : Using Linked VC Model
+		// Univeristy Issues 1 Idenitity VC and N MembershipVCs (one per group)
+		example.WriteNote("------------Case2")
+		results = append(results, runLinkedVC(groups, kt))
+
+		// Case 3 : Using one SD-JWT VC
+		// Univeristy Issues 1 SD-JWT VC with every group separately disclosable; only the TA role is presented
+		example.WriteNote("------------Case3")
+		results = append(results, runSDJWT(groups, kt))
+
+		// Case 4 : Using one BBS credential
+		// Univeristy Issues 1 BBS credential; the student derives a proof revealing only the TA role
+		example.WriteNote("------------Case4")
+		results = append(results, runBBS(groups, kt))
+
+		// Case 5 : Using one VC committing to the groups with a Merkle root
+		// Univeristy Issues 1 VC with the root; the student proves membership of the TA group only
+		example.WriteNote("------------Case5")
+		results = append(results, runMerkle(groups, kt))
+
+		// Case 6 : Using one JSON-LD VC with all the information
+		// Univeristy Issues 1 VC with an Ed25519Signature2020 proof; the student presents it in a VP with one too
+		// Ed25519Signature2020 only signs with Ed25519 keys
+		example.WriteNote("------------Case6")
+		if kt != crypto.Ed25519 {
+			example.WriteNote(fmt.Sprintf("Skipped, Data Integrity proofs need Ed25519 keys, not %s", kt))
+			continue
 		}
-		t3 = time.Since(startverify)
-		t4 = time.Since(start)
-		
+		results = append(results, runDataIntegrity(groups, kt))
+	}
+	return results
+}
 
+// runSingleVC runs case 1 - single VC with all the groups
+func runSingleVC(groups []string, kt crypto.KeyType) caseResult {
+	res := caseResult{model: "single", keyType: kt, groups: len(groups), vcCount: 1}
+	step := 0
+
+	example.WriteStep("Starting University Flow", step)
+	step++
+	start := time.Now()
+
+	// Wallet initialization
+	example.WriteStep("Initializing Student", step)
+	step++
+
+	student, err := openEntity("Student", did.KeyMethod, kt)
+	example.HandleExampleError(err, "failed to create student")
+	studentSigner, err := student.Signer()
+	example.HandleExampleError(err, "failed to build student signer")
+	studentDID := studentSigner.ID
+
+	example.WriteStep("Initializing Employer", step)
+	step++
+
+	employer, err := openEntity("Employer", "peer", kt)
+	example.HandleExampleError(err, "failed to make employer identity")
+	employerSigner, err := employer.Signer()
+	example.HandleExampleError(err, "failed to build employer signer")
+	employerDID := employerSigner.ID
+
+	example.WriteStep("Initializing University", step)
+	step++
+
+	universityMethod, universityHost, stopHost, err := hostUniversityDID()
+	example.HandleExampleError(err, "failed to host university DID")
+	defer stopHost()
+	university, err := openEntity("University", universityMethod, kt, emp.WithDIDWebHost(universityHost))
+	example.HandleExampleError(err, "failed to create university")
+	universitySigner, err := university.Signer()
+	example.HandleExampleError(err, "failed to build university signer")
+	universityDID := universitySigner.ID
+
+	example.WriteNote(fmt.Sprintf("Initialized University (Verifier) DID: %s and registered it", universityDID))
+
+	example.WriteStep("Example University Creates VC for Holder", step)
+	step++
+
+	vcID, vc, err := emp.BuildSingleVCWithGroups(*universitySigner, universityDID, studentDID, groups)
+	example.HandleExampleError(err, "failed to build vc")
+
+	example.WriteStep("Example University Sends VC to Student (Holder)", step)
+	step++
+	res.vcSize = len(vc)
+	err = student.AddCredential(vcID, vc)
+	example.HandleExampleError(err, "failed to add credentials to wallet")
+
+	msg := fmt.Sprintf("VC is stored in wallet. Wallet size is now: %d", student.GetWallet().Size())
+	example.WriteNote(msg)
+
+	example.WriteNote(fmt.Sprintf("initialized Employer (Verifier) DID: %v", employerDID))
+	example.WriteStep("Verifier wants to verify student role as TA. Sends a presentation request", step)
+	step++
+
+	presentationData, err := emp.MakePresentationData("test-id", "id-1", universityDID, crypto.SignatureAlgorithm(universitySigner.ALG))
+	example.HandleExampleError(err, "failed to create pd")
+
+	dat, err := json.Marshal(presentationData)
+	example.HandleExampleError(err, "failed to marshal presentation data")
+	logrus.Debugf("Presentation Data:\n%v", string(dat))
+
+	replayCache := emp.NewReplayCache()
+	presentationRequestJWT, err := emp.MakePresentationRequest(*employerSigner, presentationData, studentDID, replayCache.NewChallenge(emp.DefaultRequestTTL))
+	example.HandleExampleError(err, "failed to make presentation request")
+
+	example.WriteNote("Student returns claims via a Presentation Submission")
+
+	employerVerifier, err := employerSigner.ToVerifier(studentDID)
+	example.HandleExampleError(err, "failed to build employer verifier")
+	// the student's wallet picks the credentials the employer asks for; the others are not presented
+	submission, err := student.RespondToPresentationRequest(string(presentationRequestJWT), *employerVerifier)
+	example.HandleExampleError(err, "failed to build presentation submission")
+	res.presentationSize = len(submission)
+
+	verifier, err := studentSigner.ToVerifier(employerDID)
+	example.HandleExampleError(err, "failed to construct verifier")
+
+	r, err := newResolver()
+	example.HandleExampleError(err, "failed to create DID r")
+	_, _, vp, err := credential.VerifyVerifiablePresentationJWT(context.Background(), *verifier, r, string(submission))
+	example.HandleExampleError(err, "failed to verify jwt")
+
+	dat, err = json.Marshal(vp)
+	example.HandleExampleError(err, "failed to marshal submission")
+	logrus.Debugf("Submission:\n%v", string(dat))
+	logrus.Debugf("length:\n%v", len(submission))
+	startverify := time.Now()
+	example.WriteStep("Employer Attempting to Grant Access", step)
+	opts := []emp.VerifyOption{
+		emp.WithTrustedIssuers(trustedIssuers(universityDID)),
+		emp.WithPresentationDefinition(presentationData),
+		emp.WithReplayCache(replayCache),
 	}
-	
-	example.WriteNote("------------Case2")
-	
-	{
-		step := 0
+	reportDecision(emp.ValidateAccess(*verifier, r, submission, accessPolicy(universityDID), opts...))
+	if *replay {
+		example.WriteStep("Submission Replayed to the Employer", step)
+		reportDecision(emp.ValidateAccess(*verifier, r, submission, accessPolicy(universityDID), opts...))
+	}
+	res.verifyTime = time.Since(startverify)
+	res.totalTime = time.Since(start)
+	return res
+}
 
-		example.WriteStep("Starting University Flow", step)
-		step++
+// runSDJWT runs case 3 - single SD-JWT VC with all the groups, of which the student only discloses the TA role
+func runSDJWT(groups []string, kt crypto.KeyType) caseResult {
+	res := caseResult{model: "sd-jwt", keyType: kt, groups: len(groups), vcCount: 1}
+	step := 0
+
+	example.WriteStep("Starting University Flow", step)
+	step++
+	start := time.Now()
+
+	example.WriteStep("Initializing Student", step)
+	step++
+
+	student, err := emp.NewEntity("Student", did.KeyMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to create student")
+	studentDID := student.GetWallet().GetDIDs()[0]
+	studentSigner, err := student.Signer()
+	example.HandleExampleError(err, "failed to build student signer")
+
+	example.WriteStep("Initializing Employer", step)
+	step++
+
+	employer, err := emp.NewEntity("Employer", did.PeerMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to make employer identity")
+	employerDID := employer.GetWallet().GetDIDs()[0]
+	employerSigner, err := employer.Signer()
+	example.HandleExampleError(err, "failed to build employer signer")
+
+	example.WriteStep("Initializing University", step)
+	step++
+
+	universityMethod, universityHost, stopHost, err := hostUniversityDID()
+	example.HandleExampleError(err, "failed to host university DID")
+	defer stopHost()
+	university, err := emp.NewEntity("University", universityMethod, emp.WithKeyType(kt), emp.WithDIDWebHost(universityHost))
+	example.HandleExampleError(err, "failed to create university")
+	universityDID := university.GetWallet().GetDIDs()[0]
+	universitySigner, err := university.Signer()
+	example.HandleExampleError(err, "failed to build university signer")
+
+	example.WriteStep("Example University Creates SD-JWT VC for Holder", step)
+	step++
+
+	_, sdJWT, err := emp.BuildSingleSDJWTWithGroups(*universitySigner, universityDID, studentDID, groups)
+	example.HandleExampleError(err, "failed to build sd-jwt vc")
+	res.vcSize = len(sdJWT)
+
+	example.WriteStep("Verifier wants to verify student role as TA. Sends a presentation request", step)
+	step++
+
+	// no alg is asked for: a definition's claim formats cannot name vc+sd-jwt, and restricting it to jwt_vc algs
+	// would turn the SD-JWT VC down
+	presentationData, err := emp.MakePresentationData("test-id", "id-1", universityDID)
+	example.HandleExampleError(err, "failed to create pd")
+	replayCache := emp.NewReplayCache()
+	presentationRequestJWT, err := emp.MakePresentationRequest(*employerSigner, presentationData, studentDID, replayCache.NewChallenge(emp.DefaultRequestTTL))
+	example.HandleExampleError(err, "failed to make presentation request")
+
+	example.WriteNote("Student discloses only the Teaching Assistant role, bound to the request with a key binding JWT")
+	employerVerifier, err := employerSigner.ToVerifier(studentDID)
+	example.HandleExampleError(err, "failed to build employer verifier")
+	presentation, err := emp.PresentSDJWT(string(presentationRequestJWT), *employerVerifier, *studentSigner, sdJWT, emp.TeachingAssistantRole)
+	example.HandleExampleError(err, "failed to present sd-jwt")
+	res.presentationSize = len(presentation)
+	logrus.Debugf("SD-JWT presentation:\n%v", string(presentation))
+
+	r, err := newResolver()
+	example.HandleExampleError(err, "failed to create DID r")
+
+	startverify := time.Now()
+	example.WriteStep("Employer Attempting to Grant Access", step)
+	opts := []emp.VerifyOption{
+		emp.WithTrustedIssuers(trustedIssuers(universityDID)),
+		emp.WithPresentationDefinition(presentationData),
+		emp.WithReplayCache(replayCache),
+	}
+	reportDecision(emp.ValidateSDJWTAccess(employerDID, r, presentation, accessPolicy(universityDID), opts...))
+	if *replay {
+		example.WriteStep("Submission Replayed to the Employer", step)
+		reportDecision(emp.ValidateSDJWTAccess(employerDID, r, presentation, accessPolicy(universityDID), opts...))
+	}
+	res.verifyTime = time.Since(startverify)
+	res.totalTime = time.Since(start)
+	return res
+}
 
-		// Wallet initialization
-		example.WriteStep("Initializing Student", step)
-		step++
-		start := time.Now()
-		student, err := emp.NewEntity("Student", did.KeyMethod)
-		example.HandleExampleError(err, "failed to create student")
-		studentDID := student.GetWallet().GetDIDs()[0]                    //local
-		studentKeys, err := student.GetWallet().GetKeysForDID(studentDID) //local
-		studentKey := studentKeys[0].Key
-		studentKID := studentKeys[0].ID
-		example.HandleExampleError(err, "failed to get student key")
-
-		example.WriteStep("Initializing Employer", step)
-		step++
+// runBBS runs case 4 - single BBS credential with all the groups, from which the student derives a proof revealing
+// only the TA role
+func runBBS(groups []string, kt crypto.KeyType) caseResult {
+	res := caseResult{model: "bbs", keyType: kt, groups: len(groups), vcCount: 1}
+	step := 0
+
+	example.WriteStep("Starting University Flow", step)
+	step++
+	start := time.Now()
+
+	example.WriteStep("Initializing Student", step)
+	step++
+
+	student, err := emp.NewEntity("Student", did.KeyMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to create student")
+	studentDID := student.GetWallet().GetDIDs()[0]
+
+	example.WriteStep("Initializing Employer", step)
+	step++
+
+	employer, err := emp.NewEntity("Employer", did.PeerMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to make employer identity")
+	employerDID := employer.GetWallet().GetDIDs()[0]
+	employerSigner, err := employer.Signer()
+	example.HandleExampleError(err, "failed to build employer signer")
+
+	example.WriteStep("Initializing University", step)
+	step++
+
+	universityMethod, universityHost, stopHost, err := hostUniversityDID()
+	example.HandleExampleError(err, "failed to host university DID")
+	defer stopHost()
+	university, err := emp.NewEntity("University", universityMethod, emp.WithKeyType(kt), emp.WithDIDWebHost(universityHost))
+	example.HandleExampleError(err, "failed to create university")
+	universityDID := university.GetWallet().GetDIDs()[0]
+	universitySigner, err := university.Signer()
+	example.HandleExampleError(err, "failed to build university signer")
+
+	example.WriteStep("Example University Creates BBS Credential for Holder", step)
+	step++
+
+	_, bbsCred, err := emp.BuildSingleBBSWithGroups(*universitySigner, universityDID, studentDID, groups)
+	example.HandleExampleError(err, "failed to build bbs credential")
+	res.vcSize = len(bbsCred)
+
+	example.WriteStep("Verifier wants to verify student role as TA. Sends a presentation request", step)
+	step++
+
+	// no alg is asked for: a definition's claim formats cannot name bbs+vc, and restricting it to jwt_vc algs would
+	// turn the BBS credential down
+	presentationData, err := emp.MakePresentationData("test-id", "id-1", universityDID)
+	example.HandleExampleError(err, "failed to create pd")
+	replayCache := emp.NewReplayCache()
+	presentationRequestJWT, err := emp.MakePresentationRequest(*employerSigner, presentationData, studentDID, replayCache.NewChallenge(emp.DefaultRequestTTL))
+	example.HandleExampleError(err, "failed to make presentation request")
+
+	example.WriteNote("Student derives a proof revealing only the Teaching Assistant role, bound to the request's nonce")
+	employerVerifier, err := employerSigner.ToVerifier(studentDID)
+	example.HandleExampleError(err, "failed to build employer verifier")
+	presentation, err := emp.PresentBBS(string(presentationRequestJWT), *employerVerifier, bbsCred, emp.TeachingAssistantRole)
+	example.HandleExampleError(err, "failed to derive bbs proof")
+	res.presentationSize = len(presentation)
+	logrus.Debugf("BBS presentation:\n%v", string(presentation))
+
+	r, err := newResolver()
+	example.HandleExampleError(err, "failed to create DID r")
+
+	startverify := time.Now()
+	example.WriteStep("Employer Attempting to Grant Access", step)
+	opts := []emp.VerifyOption{
+		emp.WithTrustedIssuers(trustedIssuers(universityDID)),
+		emp.WithPresentationDefinition(presentationData),
+		emp.WithReplayCache(replayCache),
+	}
+	reportDecision(emp.ValidateBBSAccess(employerDID, r, presentation, accessPolicy(universityDID), opts...))
+	if *replay {
+		example.WriteStep("Submission Replayed to the Employer", step)
+		reportDecision(emp.ValidateBBSAccess(employerDID, r, presentation, accessPolicy(universityDID), opts...))
+	}
+	res.verifyTime = time.Since(startverify)
+	res.totalTime = time.Since(start)
+	return res
+}
 
-		employer, err := emp.NewEntity("Employer", "peer")
-		example.HandleExampleError(err, "failed to make employer identity")
-		employerDID := employer.GetWallet().GetDIDs()[0]                     // from personal wallet
-		employerKeys, err := employer.GetWallet().GetKeysForDID(employerDID) //from personal wallet
-		employerKey := employerKeys[0].Key
-		employerKID := employerKeys[0].ID
-		example.HandleExampleError(err, "failed to get employer key")
+// runMerkle runs case 5 - single VC committing to all the groups with a Merkle root, of which the student proves
+// membership of the TA group only
+func runMerkle(groups []string, kt crypto.KeyType) caseResult {
+	res := caseResult{model: "merkle", keyType: kt, groups: len(groups), vcCount: 1}
+	step := 0
+
+	example.WriteStep("Starting University Flow", step)
+	step++
+	start := time.Now()
+
+	example.WriteStep("Initializing Student", step)
+	step++
+
+	student, err := emp.NewEntity("Student", did.KeyMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to create student")
+	studentDID := student.GetWallet().GetDIDs()[0]
+	studentSigner, err := student.Signer()
+	example.HandleExampleError(err, "failed to build student signer")
+
+	example.WriteStep("Initializing Employer", step)
+	step++
+
+	employer, err := emp.NewEntity("Employer", did.PeerMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to make employer identity")
+	employerDID := employer.GetWallet().GetDIDs()[0]
+	employerSigner, err := employer.Signer()
+	example.HandleExampleError(err, "failed to build employer signer")
+
+	example.WriteStep("Initializing University", step)
+	step++
+
+	universityMethod, universityHost, stopHost, err := hostUniversityDID()
+	example.HandleExampleError(err, "failed to host university DID")
+	defer stopHost()
+	university, err := emp.NewEntity("University", universityMethod, emp.WithKeyType(kt), emp.WithDIDWebHost(universityHost))
+	example.HandleExampleError(err, "failed to create university")
+	universityDID := university.GetWallet().GetDIDs()[0]
+	universitySigner, err := university.Signer()
+	example.HandleExampleError(err, "failed to build university signer")
+
+	example.WriteStep("Example University Creates Group Commitment VC for Holder", step)
+	step++
+
+	vcID, vc, openings, err := emp.BuildGroupCommitmentVC(*universitySigner, universityDID, studentDID, groups)
+	example.HandleExampleError(err, "failed to build group commitment vc")
+
+	example.WriteStep("Example University Sends VC and Group Openings to Student (Holder)", step)
+	step++
+	res.vcSize = len(vc)
+	err = student.AddGroupCommitment(vcID, vc, openings)
+	example.HandleExampleError(err, "failed to add credentials to wallet")
+
+	example.WriteStep("Verifier wants to verify student role as TA. Sends a presentation request", step)
+	step++
+
+	presentationData, err := emp.MakePresentationData("test-id", "id-1", universityDID, crypto.SignatureAlgorithm(universitySigner.ALG))
+	example.HandleExampleError(err, "failed to create pd")
+	replayCache := emp.NewReplayCache()
+	presentationRequestJWT, err := emp.MakePresentationRequest(*employerSigner, presentationData, studentDID, replayCache.NewChallenge(emp.DefaultRequestTTL))
+	example.HandleExampleError(err, "failed to make presentation request")
+
+	example.WriteNote("Student returns the VC with a Merkle proof of the Teaching Assistant group via a Presentation Submission")
+	employerVerifier, err := employerSigner.ToVerifier(studentDID)
+	example.HandleExampleError(err, "failed to build employer verifier")
+	submission, err := student.RespondWithGroupProofs(string(presentationRequestJWT), *employerVerifier, emp.TeachingAssistantRole)
+	example.HandleExampleError(err, "failed to build presentation submission")
+	res.presentationSize = len(submission)
+	logrus.Debugf("Submission:\n%v", string(submission))
+
+	verifier, err := studentSigner.ToVerifier(employerDID)
+	example.HandleExampleError(err, "failed to construct verifier")
+	r, err := newResolver()
+	example.HandleExampleError(err, "failed to create DID r")
+
+	startverify := time.Now()
+	example.WriteStep("Employer Attempting to Grant Access", step)
+	opts := []emp.VerifyOption{
+		emp.WithTrustedIssuers(trustedIssuers(universityDID)),
+		emp.WithPresentationDefinition(presentationData),
+		emp.WithReplayCache(replayCache),
+	}
+	reportDecision(emp.ValidateGroupAccess(*verifier, r, submission, accessPolicy(universityDID), opts...))
+	if *replay {
+		example.WriteStep("Submission Replayed to the Employer", step)
+		reportDecision(emp.ValidateGroupAccess(*verifier, r, submission, accessPolicy(universityDID), opts...))
+	}
+	res.verifyTime = time.Since(startverify)
+	res.totalTime = time.Since(start)
+	return res
+}
 
-		example.WriteStep("Initializing University", step)
-		step++
+// runDataIntegrity runs case 6 - single JSON-LD VC with all the groups, issued and presented with Data Integrity
+// proofs instead of as JWTs
+func runDataIntegrity(groups []string, kt crypto.KeyType) caseResult {
+	res := caseResult{model: "ldp", keyType: kt, groups: len(groups), vcCount: 1}
+	step := 0
+
+	example.WriteStep("Starting University Flow", step)
+	step++
+	start := time.Now()
+
+	example.WriteStep("Initializing Student", step)
+	step++
+
+	student, err := emp.NewEntity("Student", did.KeyMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to create student")
+	studentDID := student.GetWallet().GetDIDs()[0]
+
+	example.WriteStep("Initializing Employer", step)
+	step++
+
+	employer, err := emp.NewEntity("Employer", did.PeerMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to make employer identity")
+	employerDID := employer.GetWallet().GetDIDs()[0]
+	employerSigner, err := employer.Signer()
+	example.HandleExampleError(err, "failed to build employer signer")
+
+	example.WriteStep("Initializing University", step)
+	step++
+
+	universityMethod, universityHost, stopHost, err := hostUniversityDID()
+	example.HandleExampleError(err, "failed to host university DID")
+	defer stopHost()
+	university, err := emp.NewEntity("University", universityMethod, emp.WithKeyType(kt), emp.WithDIDWebHost(universityHost))
+	example.HandleExampleError(err, "failed to create university")
+	universityDID := university.GetWallet().GetDIDs()[0]
+	universitySigner, err := university.Signer()
+	example.HandleExampleError(err, "failed to build university signer")
+
+	example.WriteStep("Example University Creates JSON-LD VC for Holder", step)
+	step++
+
+	vcID, vc, err := emp.BuildSingleLDVCWithGroups(*universitySigner, universityDID, studentDID, groups)
+	example.HandleExampleError(err, "failed to build ld vc")
+	res.vcSize = len(vc)
+	err = student.AddCredential(vcID, vc)
+	example.HandleExampleError(err, "failed to add credentials to wallet")
+
+	example.WriteStep("Verifier wants to verify student role as TA. Sends a presentation request", step)
+	step++
+
+	presentationData, err := emp.MakeLDPresentationData("test-id", "id-1", universityDID)
+	example.HandleExampleError(err, "failed to create pd")
+	replayCache := emp.NewReplayCache()
+	presentationRequestJWT, err := emp.MakePresentationRequest(*employerSigner, presentationData, studentDID, replayCache.NewChallenge(emp.DefaultRequestTTL))
+	example.HandleExampleError(err, "failed to make presentation request")
+
+	example.WriteNote("Student returns the VC in a VP whose proof is bound to the request's nonce and to the employer")
+	employerVerifier, err := employerSigner.ToVerifier(studentDID)
+	example.HandleExampleError(err, "failed to build employer verifier")
+	presentation, err := student.RespondWithDataIntegrity(string(presentationRequestJWT), *employerVerifier)
+	example.HandleExampleError(err, "failed to build presentation submission")
+	res.presentationSize = len(presentation)
+	logrus.Debugf("Data Integrity presentation:\n%v", string(presentation))
+
+	r, err := newResolver()
+	example.HandleExampleError(err, "failed to create DID r")
+
+	startverify := time.Now()
+	example.WriteStep("Employer Attempting to Grant Access", step)
+	opts := []emp.VerifyOption{
+		emp.WithTrustedIssuers(trustedIssuers(universityDID)),
+		emp.WithPresentationDefinition(presentationData),
+		emp.WithReplayCache(replayCache),
+	}
+	reportDecision(emp.ValidateDataIntegrityAccess(employerDID, r, presentation, accessPolicy(universityDID), opts...))
+	if *replay {
+		example.WriteStep("Submission Replayed to the Employer", step)
+		reportDecision(emp.ValidateDataIntegrityAccess(employerDID, r, presentation, accessPolicy(universityDID), opts...))
+	}
+	res.verifyTime = time.Since(startverify)
+	res.totalTime = time.Since(start)
+	return res
+}
 
-		university, err := emp.NewEntity("University", did.PeerMethod)
-		example.HandleExampleError(err, "failed to create university")
-		universityDID := university.GetWallet().GetDIDs()[0]
-		universityKeys, err := university.GetWallet().GetKeysForDID(universityDID)
-		universityKey := universityKeys[0].Key
-		universityKID := universityKeys[0].ID
-		example.HandleExampleError(err, "failed to get university key")
+// runLinkedVC runs case 2 - one identity VC and one membership VC per group
+func runLinkedVC(groups []string, kt crypto.KeyType) caseResult {
+	res := caseResult{model: "linked", keyType: kt, groups: len(groups), vcCount: 1 + len(groups)}
+	step := 0
+
+	example.WriteStep("Starting University Flow", step)
+	step++
+
+	// Wallet initialization
+	example.WriteStep("Initializing Student", step)
+	step++
+	start := time.Now()
+	student, err := emp.NewEntity("Student", did.KeyMethod, emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to create student")
+	studentSigner, err := student.Signer()
+	example.HandleExampleError(err, "failed to build student signer")
+	studentDID := studentSigner.ID
+
+	example.WriteStep("Initializing Employer", step)
+	step++
+
+	employer, err := emp.NewEntity("Employer", "peer", emp.WithKeyType(kt))
+	example.HandleExampleError(err, "failed to make employer identity")
+	employerSigner, err := employer.Signer()
+	example.HandleExampleError(err, "failed to build employer signer")
+	employerDID := employerSigner.ID
+
+	example.WriteStep("Initializing University", step)
+	step++
+
+	universityMethod, universityHost, stopHost, err := hostUniversityDID()
+	example.HandleExampleError(err, "failed to host university DID")
+	defer stopHost()
+	university, err := emp.NewEntity("University", universityMethod, emp.WithKeyType(kt), emp.WithDIDWebHost(universityHost))
+	example.HandleExampleError(err, "failed to create university")
+	universitySigner, err := university.Signer()
+	example.HandleExampleError(err, "failed to build university signer")
+	universityDID := universitySigner.ID
+
+	example.WriteNote(fmt.Sprintf("Initialized University (Verifier) DID: %s and registered it", universityDID))
+
+	example.WriteStep("Example University Creates Identity-VC for Holder", step)
+	step++
+
+	// the university publishes the status lists of the membership VCs so they can be revoked later
+	publisher, err := emp.NewPublisher("127.0.0.1:0")
+	example.HandleExampleError(err, "failed to start status list publisher")
+	defer publisher.Close()
+	statusRegistry := university.InitStatusRegistry(*universitySigner, publisher.URL+"/status")
+	publisher.Handle("/status/", statusRegistry)
+	example.WriteNote(fmt.Sprintf("University publishes its status lists at %s/status", publisher.URL))
+
+	vcID, vc, err := emp.BuildSampleIdentityVC(*universitySigner, universityDID, studentDID)
+	example.HandleExampleError(err, "failed to build vc")
+
+	example.WriteStep("Example University Sends VC to Student (Holder)", step)
+	step++
+
+	err = student.AddCredential(vcID, vc)
+	example.HandleExampleError(err, "failed to add credentials to wallet")
+	res.vcSize = len(vc)
+	msg := fmt.Sprintf("VC is stored in wallet. Wallet size is now: %d", student.GetWallet().Size())
+	example.WriteNote(msg)
+
+	// adding membership
+	example.WriteStep(fmt.Sprintf("Example University Creates %d MembershipVCs for Holder", len(groups)), step)
+	step++
+
+	membershipIDs, membershipVCs, err := emp.BuildMembershipVCs(*universitySigner, universityDID, studentDID, emp.NewIdentityLink(vcID, vc), groups, emp.WithStatus(statusRegistry))
+	example.HandleExampleError(err, "failed to build vc")
+	example.WriteStep("Example University Sends VCs to Student (Holder)", step)
+	step++
+
+	for i, membershipVC := range membershipVCs {
+		res.vcSize += len(membershipVC)
+		err = student.AddCredential(membershipIDs[i], membershipVC)
+		example.HandleExampleError(err, "failed to add credentials to wallet")
+	}
 
-		example.WriteNote(fmt.Sprintf("Initialized University (Verifier) DID: %s and registered it", universityDID))
+	msg2 := fmt.Sprintf("VC is stored in wallet. Wallet size is now: %d", student.GetWallet().Size())
+	example.WriteNote(msg2)
+
+	if *revoke {
+		// membership can be revoked without touching the identity VC
+		for i, group := range groups {
+			if group == emp.TeachingAssistantRole {
+				err = statusRegistry.Revoke(membershipIDs[i])
+				example.HandleExampleError(err, "failed to revoke membership")
+				example.WriteNote(fmt.Sprintf("University revoked the %s membership VC %s", group, membershipIDs[i]))
+			}
+		}
+	}
 
-		example.WriteStep("Example University Creates Identity-VC for Holder", step)
+	// the employer resolves DIDs with the registry the university publishes its DID document to when it rotates keys
+	baseResolver, err := newResolver()
+	example.HandleExampleError(err, "failed to create DID r")
+	didRegistry := emp.NewDIDRegistry(baseResolver)
+	if *rotate {
+		// the VCs issued so far stay verifiable with the old key during the grace period
+		example.WriteStep("Example University Rotates its Signing Key", step)
 		step++
+		// a did:web document is changed where it is hosted; the documents of other DIDs are published to the registry
+		var docs emp.DIDPublisher = didRegistry
+		if universityHost != nil {
+			docs = universityHost
+		}
+		_, err = university.RotateKey(docs, emp.DefaultKeyGracePeriod)
+		example.HandleExampleError(err, "failed to rotate university key")
+	}
 
-		universitySigner, err := jwx.NewJWXSigner(universityDID, universityKID, universityKey)
-		example.HandleExampleError(err, "failed to build university signer")
-		vcID, vc, err := emp.BuildSampleIdentityVC(*universitySigner, universityDID, studentDID)
-		example.HandleExampleError(err, "failed to build vc")
-
-		example.WriteStep("Example University Sends VC to Student (Holder)", step)
-		step++
+	example.WriteNote(fmt.Sprintf("initialized Employer (Verifier) DID: %v", employerDID))
+	example.WriteStep("Employer wants to verify student graduated from Example University. Sends a presentation request", step)
+	step++
+
+	presentationData := presentationDefinition(universityDID, crypto.SignatureAlgorithm(universitySigner.ALG))
+	dat, err := json.Marshal(presentationData)
+	example.HandleExampleError(err, "failed to marshal presentation data")
+	logrus.Debugf("Presentation Data:\n%v", string(dat))
+
+	replayCache := emp.NewReplayCache()
+	presentationRequestJWT, err := emp.MakePresentationRequest(*employerSigner, presentationData, studentDID, replayCache.NewChallenge(emp.DefaultRequestTTL))
+	example.HandleExampleError(err, "failed to make presentation request")
+
+	example.WriteNote("Student returns claims via a Presentation Submission")
+
+	employerVerifier, err := employerSigner.ToVerifier(studentDID)
+	example.HandleExampleError(err, "failed to build employer verifier")
+	// the student's wallet picks the credentials the employer asks for; the others are not presented
+	submission, err := student.RespondToPresentationRequest(string(presentationRequestJWT), *employerVerifier)
+	example.HandleExampleError(err, "failed to build presentation submission")
+	res.presentationSize = len(submission)
+
+	verifier, err := studentSigner.ToVerifier(employerDID)
+	example.HandleExampleError(err, "failed to construct verifier")
+
+	r := didRegistry
+	_, _, vp, err := credential.VerifyVerifiablePresentationJWT(context.Background(), *verifier, r, string(submission))
+	example.HandleExampleError(err, "failed to verify jwt")
+
+	dat, err = json.Marshal(vp)
+	example.HandleExampleError(err, "failed to marshal submission")
+	logrus.Debugf("Submission:\n%v", string(dat))
+	logrus.Debugf("length:\n%v", len(submission))
+	startverify := time.Now()
+	example.WriteStep("Employer Attempting to Grant Access", step)
+	opts := []emp.VerifyOption{
+		emp.WithTrustedIssuers(trustedIssuers(universityDID)),
+		emp.WithPresentationDefinition(presentationData),
+		emp.WithReplayCache(replayCache),
+	}
+	reportDecision(emp.ValidateAccess(*verifier, r, submission, accessPolicy(universityDID), opts...))
+	if *replay {
+		example.WriteStep("Submission Replayed to the Employer", step)
+		reportDecision(emp.ValidateAccess(*verifier, r, submission, accessPolicy(universityDID), opts...))
+	}
+	res.verifyTime = time.Since(startverify)
+	res.totalTime = time.Since(start)
+	return res
+}
 
-		err = student.GetWallet().AddCredentialJWT(vcID, vc)
-		example.HandleExampleError(err, "failed to add credentials to wallet")
-        size2 = len(vc)
-		msg := fmt.Sprintf("VC is stored in wallet. Wallet size is now: %d", student.GetWallet().Size())
-		example.WriteNote(msg)
+// newResolver resolves the DIDs of the entities: did:key, did:peer and, from the local servers hosting them, did:web
+func newResolver() (*resolution.MultiMethodResolver, error) {
+	return resolution.NewResolver([]resolution.Resolver{key.Resolver{}, peer.Resolver{}, emp.WebResolver{AllowHTTP: true}}...)
+}
 
-		// adding membership
-		example.WriteStep("Example University Creates MembershipVC for Holder", step)
-		step++
+// hostUniversityDID returns the DID method of the university. With -didweb it is did:web, and a local server hosts
+// the university's DID document until stop is called; otherwise it is did:peer and host is nil.
+func hostUniversityDID() (method did.Method, host *emp.DIDWebHost, stop func(), err error) {
+	if !*webDID {
+		return did.PeerMethod, nil, func() {}, nil
+	}
+	publisher, err := emp.NewPublisher("127.0.0.1:0")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if host, err = emp.NewDIDWebHost(publisher.URL); err != nil {
+		_ = publisher.Close()
+		return "", nil, nil, err
+	}
+	publisher.Handle("/", host)
+	example.WriteNote(fmt.Sprintf("University hosts its DID document at %s", publisher.URL))
+	return did.WebMethod, host, func() { _ = publisher.Close() }, nil
+}
 
-		vcID2, vc2, err2 := emp.BuildMembershipVC(*universitySigner, universityDID, studentDID)
-		example.HandleExampleError(err2, "failed to build vc")
-        size3 = len(vc2)
-		example.WriteStep("Example University Sends VC to Student (Holder)", step)
-		step++
+// openEntity makes an entity of case 1. With -wallets its wallet is kept in <dir>/<name>.wallet and its keys in
+// <dir>/<name>.keys, so it has the same DID and credentials on every run; otherwise it starts from a new wallet.
+func openEntity(name string, didMethod did.Method, kt crypto.KeyType, opts ...emp.EntityOption) (*emp.Entity, error) {
+	opts = append(opts, emp.WithKeyType(kt))
+	if *walletDir == "" {
+		return emp.NewEntity(name, didMethod, opts...)
+	}
+	if err := os.MkdirAll(*walletDir, 0o700); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(*walletDir, strings.ToLower(name))
+	store, err := emp.NewFileWalletStore(base+".wallet", os.Getenv(walletPassphraseEnv))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := emp.NewFileKeyManager(base+".keys", os.Getenv(walletPassphraseEnv))
+	if err != nil {
+		return nil, err
+	}
+	return emp.OpenEntity(name, didMethod, store, append(opts, emp.WithKeyManager(keys))...)
+}
 
-		err = student.GetWallet().AddCredentialJWT(vcID2, vc2)
-		example.HandleExampleError(err, "failed to add credentials to wallet")
+// accessPolicy returns the policy given with -policy, or the Teaching Assistant policy trusting the university
+func accessPolicy(universityDID string) emp.AccessPolicy {
+	if *policyFile == "" {
+		return emp.TeachingAssistantPolicy(universityDID)
+	}
+	policy, err := emp.LoadAccessPolicy(*policyFile)
+	example.HandleExampleError(err, "failed to load access policy")
+	return *policy
+}
 
-		msg2 := fmt.Sprintf("VC is stored in wallet. Wallet size is now: %d", student.GetWallet().Size())
-		example.WriteNote(msg2)
+// presentationDefinition returns the definition given with -definition, or the identity VC and a Teaching
+// Assistant membership from the university, signed with its alg
+func presentationDefinition(universityDID string, alg crypto.SignatureAlgorithm) exchange.PresentationDefinition {
+	if *defFile == "" {
+		def, err := emp.MakeCombinedPresentationData("test-id", "id-1", "id-2", universityDID, emp.TeachingAssistantRole, alg)
+		example.HandleExampleError(err, "failed to create pd")
+		return def
+	}
+	def, err := emp.LoadPresentationDefinition(*defFile)
+	example.HandleExampleError(err, "failed to load presentation definition")
+	return def
+}
 
-		example.WriteNote(fmt.Sprintf("initialized Employer (Verifier) DID: %v", employerDID))
-		example.WriteStep("Employer wants to verify student graduated from Example University. Sends a presentation request", step)
-		step++
+// trustedIssuers returns the registry given with -issuers, or one trusting the university for the alumni credentials
+// it issues in the demo
+func trustedIssuers(universityDID string) *emp.TrustedIssuerRegistry {
+	if *issuerFile != "" {
+		registry, err := emp.LoadTrustedIssuers(*issuerFile)
+		example.HandleExampleError(err, "failed to load trusted issuers")
+		return registry
+	}
+	registry, err := emp.NewTrustedIssuerRegistry(emp.TrustedIssuer{
+		DID:   universityDID,
+		Name:  "XYZ University",
+		Types: []string{"AlumniCredential", "AlumniMemberCredential"},
+	})
+	example.HandleExampleError(err, "failed to build trusted issuers")
+	return registry
+}
 
-		presentationData, err := emp.MakeCombinedPresentationData("test-id", "id-1", "id-2", universityDID)
-		example.HandleExampleError(err, "failed to create pd")
-		dat, err := json.Marshal(presentationData)
-		psize2 =         len(dat)  
-
-		example.HandleExampleError(err, "failed to marshal presentation data")
-		logrus.Debugf("Presentation Data:\n%v", string(dat))
-
-		presentationRequestJWT, employerSigner, err := emp.MakePresentationRequest(employerKey, employerKID, presentationData, employerDID, studentDID)
-		example.HandleExampleError(err, "failed to make presentation request")
-
-		studentSigner, err := jwx.NewJWXSigner(studentDID, studentKID, studentKey)
-		example.HandleExampleError(err, "failed to build json web key signer")
-
-		example.WriteNote("Student returns claims via a Presentation Submission")
-
-		employerVerifier, err := employerSigner.ToVerifier(studentDID)
-		example.HandleExampleError(err, "failed to build employer verifier")
-		submission, err := emp.BuildCombinedPresentationSubmission(string(presentationRequestJWT), *employerVerifier, *studentSigner, vc, vc2)
-		example.HandleExampleError(err, "failed to build presentation submission")
-
-		verifier, err := studentSigner.ToVerifier(employerDID)
-		example.HandleExampleError(err, "failed to construct verifier")
-
-		r, err := resolution.NewResolver([]resolution.Resolver{key.Resolver{}, peer.Resolver{}}...)
-		example.HandleExampleError(err, "failed to create DID r")
-		_, _, vp, err := credential.VerifyVerifiablePresentationJWT(context.Background(), *verifier, r, string(submission))
-		example.HandleExampleError(err, "failed to verify jwt")
-
-		dat, err = json.Marshal(vp)
-		example.HandleExampleError(err, "failed to marshal submission")
-		logrus.Debugf("Submission:\n%v", string(dat))
-		tokenSize := len(dat)
-		logrus.Debugf("length:\n%v", tokenSize)
-		startverify := time.Now()
-		example.WriteStep(fmt.Sprintf("Employer Attempting to Grant Access"), step)
-		if err = emp.ValidateAccess(*verifier, r, submission); err == nil {
-			example.WriteOK("Access Granted!")
-		} else {
-			example.WriteError(fmt.Sprintf("Access was not granted! Reason: %s", err))
+// reportDecision prints whether the employer granted access, with the credentials and claims that granted it
+// or every reason it was denied
+func reportDecision(decision emp.AccessDecision) {
+	if !decision.Allowed {
+		example.WriteError("Access was not granted!")
+		for _, reason := range decision.Reasons {
+			example.WriteError(fmt.Sprintf("Reason: %s", reason))
 		}
-		t1 = time.Since(startverify)
-		t2 = time.Since(start)
-		
-
+		return
 	}
+	example.WriteOK("Access Granted!")
+	example.WriteNote(fmt.Sprintf("Matched credentials: %s", strings.Join(decision.MatchedCredentialIDs(), ", ")))
+	for _, claim := range decision.MatchedClaims {
+		example.WriteNote(fmt.Sprintf("%s: %s = %v", claim.Requirement, claim.Path, claim.Value))
+	}
+}
+
+// printSummary prints the measurements of a single run of all cases
+func printSummary(results []caseResult) {
 	fmt.Println("Time Taken--------------------")
-	fmt.Println("time taken to verify took in 1st case : ", t1)
-	fmt.Println("total time taken in 1st Case :", t2)
-	fmt.Println("time taken to verify took in 2nd case :", t3)
-	fmt.Println("total time taken in 2nd Case :", t4)
-    
+	for _, r := range results {
+		fmt.Printf("time taken to verify in %s VC model (%s keys, %d groups): %v\n", r.model, r.keyType, r.groups, r.verifyTime)
+		fmt.Printf("total time taken in %s VC model (%s keys, %d groups): %v\n", r.model, r.keyType, r.groups, r.totalTime)
+	}
+
 	fmt.Println("VC sizes--------------------")
-	fmt.Println ("VC size in 1st case - single VC with 20 groups:", size1)
-	fmt.Println ("VC size in 2nd case - identity VC:", size2)
-	fmt.Println ("VC size in 2nd case - 1 membership VC:", size3)
+	for _, r := range results {
+		fmt.Printf("VC size in %s VC model (%s keys, %d groups, %d VCs): %d\n", r.model, r.keyType, r.groups, r.vcCount, r.vcSize)
+	}
 
 	fmt.Println("Presentation sizes.............. ")
-	fmt.Println("Presentation size in case 1 (single VC with 20 groups) :", psize1)
-    fmt.Println("Presentation size in case 2 (linked VC) :", psize2)
+	for _, r := range results {
+		fmt.Printf("Presentation size in %s VC model (%s keys, %d groups): %d\n", r.model, r.keyType, r.groups, r.presentationSize)
+	}
+}
 
-	
+// printCSV writes the measurements of a sweep to w so they can be charted
+func printCSV(w io.Writer, results []caseResult) error {
+	if _, err := fmt.Fprintln(w, "model,key_type,groups,vc_count,vc_bytes,presentation_bytes,verify_ns,total_ns"); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s,%s,%d,%d,%d,%d,%d,%d\n", r.model, r.keyType, r.groups, r.vcCount, r.vcSize,
+			r.presentationSize, r.verifyTime.Nanoseconds(), r.totalTime.Nanoseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,456 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/goccy/go-json"
+	bbsg2 "github.com/hyperledger/aries-framework-go/pkg/crypto/primitive/bbs12381g2pub"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+// BBSFormat is the claim format of BBS credentials in presentation definitions
+const BBSFormat = "bbs+vc"
+
+const (
+	// bbsAlg is the signature scheme of BBS credentials, as listed under alg in a claim format
+	bbsAlg = "BLS12-381-G2"
+	// bbsKeyJWTType is the typ of the JWT in which an issuer certifies its BBS public key with its DID key
+	bbsKeyJWTType = "bbs-key+jwt"
+	bbsKeyClaim   = "bbs_key"
+)
+
+// bbsRevealedClaims are the claims of a BBS credential which every presentation reveals. The holder's DID (sub)
+// and the credential id (jti) are hidden unless asked for, as either would link presentations together.
+var bbsRevealedClaims = []string{jwt.IssuerKey, jwt.NotBeforeKey, jwt.ExpirationKey, vctClaim, statusClaim}
+
+// bbsMessage is one message signed in a BBS credential: a claim, or one element of an array claim
+type bbsMessage struct {
+	Name    string `json:"name"`
+	Value   any    `json:"value"`
+	Element bool   `json:"element,omitempty"`
+}
+
+// matches reports whether the message is one a holder chose to reveal, like Disclosure.matches
+func (m bbsMessage) matches(choice string) bool {
+	if !m.Element {
+		return m.Name == choice
+	}
+	return Disclosure{Value: m.Value}.matches(choice)
+}
+
+// BBSCredential is a credential signed with BBS: one message per claim, or per element of an array claim, and a
+// signature over all of them. IssuerKey is the issuer's BBS public key, certified by a JWT signed with its DID key.
+type BBSCredential struct {
+	IssuerKey string   `json:"issuerKey"`
+	Messages  []string `json:"messages"`
+	Signature string   `json:"signature"`
+}
+
+// BBSPresentation is a proof derived from a BBS credential: the revealed messages, in signing order, and a zero
+// knowledge proof that the issuer signed them along with the hidden ones. The proof is bound to the request by
+// its audience and nonce; a new one is derived for every request, so two presentations cannot be linked by it.
+type BBSPresentation struct {
+	IssuerKey string   `json:"issuerKey"`
+	Messages  []string `json:"messages"`
+	Proof     string   `json:"proof"`
+	Audience  string   `json:"aud"`
+	Nonce     string   `json:"nonce"`
+}
+
+// IssuedBBS is the result of a BBS issuance: the credential with every message, for the holder to keep
+type IssuedBBS struct {
+	ID         string
+	Credential string
+}
+
+// bbsIssuerKey is an issuer's BBS key pair and the JWT certifying its public key
+type bbsIssuerKey struct {
+	signer *crypto.BBSPlusSigner
+	keyJWT string
+}
+
+// bbsKey returns the issuer's BBS key, making one and certifying it with the issuer's DID key on first use
+func (i *Issuer) bbsKey() (*bbsIssuerKey, error) {
+	if i.bbs != nil {
+		return i.bbs, nil
+	}
+	pub, priv, err := crypto.GenerateBBSKeyPair()
+	if err != nil {
+		return nil, errors.Wrap(err, "generating BBS key")
+	}
+	pubBytes, err := pub.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	keyJWT, err := signTypedJWT(i.signer, bbsKeyJWTType, map[string]any{
+		jwt.IssuerKey:   i.DID(),
+		jwt.IssuedAtKey: time.Now().Unix(),
+		bbsKeyClaim:     base64.RawURLEncoding.EncodeToString(pubBytes),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "certifying BBS key")
+	}
+	i.bbs = &bbsIssuerKey{signer: crypto.NewBBSPlusSigner(i.signer.KID, priv), keyJWT: keyJWT}
+	return i.bbs, nil
+}
+
+// IssueBBS Makes a credential from the template for recipientDID and signs it with BBS. Every subject claim is a
+// message of its own and an array claim gets one message per element, so e.g. each role can be revealed on its
+// own. The issuer's BBS key is made on first use and certified with its DID key.
+func (i *Issuer) IssueBBS(t CredentialTemplate, recipientDID string, opts ...IssueOption) (*IssuedBBS, error) {
+	cred, err := i.newCredential(t, recipientDID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	key, err := i.bbsKey()
+	if err != nil {
+		return nil, err
+	}
+	validFrom, err := time.Parse(time.RFC3339, cred.IssuanceDate)
+	if err != nil {
+		return nil, err
+	}
+	types := t.types()
+	messages := []bbsMessage{
+		{Name: jwt.IssuerKey, Value: i.DID()},
+		{Name: jwt.SubjectKey, Value: recipientDID},
+		{Name: jwt.JwtIDKey, Value: cred.ID},
+		{Name: jwt.NotBeforeKey, Value: validFrom.Unix()},
+		{Name: vctClaim, Value: types[len(types)-1]},
+	}
+	// exp and status are signed as null when the credential has none, so a proof cannot hide that it has them
+	var validUntil any
+	if cred.ExpirationDate != "" {
+		exp, err := time.Parse(time.RFC3339, cred.ExpirationDate)
+		if err != nil {
+			return nil, err
+		}
+		validUntil = exp.Unix()
+	}
+	messages = append(messages,
+		bbsMessage{Name: jwt.ExpirationKey, Value: validUntil},
+		bbsMessage{Name: statusClaim, Value: cred.CredentialStatus},
+	)
+
+	// sorted so the messages are in the same order for every credential issued from the template
+	names := make([]string, 0, len(cred.CredentialSubject))
+	for name := range cred.CredentialSubject {
+		if name != "id" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := cred.CredentialSubject[name]
+		elements, ok := value.([]any)
+		if !ok {
+			messages = append(messages, bbsMessage{Name: name, Value: value})
+			continue
+		}
+		for _, element := range elements {
+			messages = append(messages, bbsMessage{Name: name, Value: element, Element: true})
+		}
+	}
+
+	encoded := make([]string, 0, len(messages))
+	signed := make([][]byte, 0, len(messages))
+	for _, m := range messages {
+		dat, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, string(dat))
+		signed = append(signed, dat)
+	}
+	signature, err := key.signer.SignMultiple(signed...)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing BBS credential")
+	}
+	dat, err := json.Marshal(BBSCredential{
+		IssuerKey: key.keyJWT,
+		Messages:  encoded,
+		Signature: base64.RawURLEncoding.EncodeToString(signature),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	example.WriteNote(fmt.Sprintf("BBS credential issued from %s to %s with %d messages", i.DID(), recipientDID, len(messages)))
+	return &IssuedBBS{ID: cred.ID, Credential: string(dat)}, nil
+}
+
+// BuildSingleBBSWithGroups is BuildSingleVCWithGroups issuing a BBS credential in which every role can be revealed
+// on its own
+func BuildSingleBBSWithGroups(signer jwx.Signer, universityDID, recipientDID string, groups []string, opts ...IssueOption) (credID string, cred string, err error) {
+	issuer, err := builderIssuer(signer, universityDID)
+	if err != nil {
+		return "", "", err
+	}
+	issued, err := issuer.IssueBBS(SingleVCTemplate(groups), recipientDID, opts...)
+	if err != nil {
+		return "", "", err
+	}
+	return issued.ID, issued.Credential, nil
+}
+
+// PresentBBS answers a presentation request with a proof derived from a BBS credential. The proof reveals the
+// issuer, type, validity window and status of the credential, and the claims chosen by name or
+// value (see Disclosure); every other message stays hidden. Every choice must match a message.
+// The proof is not bound to the holder's DID, which would make presentations linkable, but to the request:
+// its audience and nonce are part of it.
+func PresentBBS(presentationRequestJWT string, requestVerifier jwx.Verifier, bbsCred string, disclose ...string) ([]byte, error) {
+	req, err := parsePresentationRequest(presentationRequestJWT, requestVerifier)
+	if err != nil {
+		return nil, err
+	}
+	var cred BBSCredential
+	if err = json.Unmarshal([]byte(bbsCred), &cred); err != nil {
+		return nil, errors.Wrap(err, "parsing BBS credential")
+	}
+	keyToken, pub, err := parseBBSKey(cred.IssuerKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(cred.Signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding BBS signature")
+	}
+
+	chosen := make(map[string]bool, len(disclose))
+	messages := make([][]byte, 0, len(cred.Messages))
+	var revealed []int
+	var presented []string
+	for i, encoded := range cred.Messages {
+		var m bbsMessage
+		if err = json.Unmarshal([]byte(encoded), &m); err != nil {
+			return nil, errors.Wrapf(err, "parsing BBS message %d", i)
+		}
+		messages = append(messages, []byte(encoded))
+		reveal := util.Contains(m.Name, bbsRevealedClaims)
+		for _, choice := range disclose {
+			if m.matches(choice) {
+				chosen[choice] = true
+				reveal = true
+			}
+		}
+		if reveal {
+			revealed = append(revealed, i)
+			presented = append(presented, encoded)
+		}
+	}
+	for _, choice := range disclose {
+		if !chosen[choice] {
+			return nil, fmt.Errorf("BBS credential has no message for<%s>", choice)
+		}
+	}
+
+	proof, err := crypto.NewBBSPlusVerifier(keyToken.Issuer(), pub).DeriveProof(messages, signature, bbsProofNonce(req.requester, req.nonce), revealed)
+	if err != nil {
+		return nil, errors.Wrap(err, "deriving BBS proof")
+	}
+	example.WriteNote(fmt.Sprintf("Holder revealed %d of %d messages of the BBS credential", len(revealed), len(messages)))
+	return json.Marshal(BBSPresentation{
+		IssuerKey: cred.IssuerKey,
+		Messages:  presented,
+		Proof:     base64.RawURLEncoding.EncodeToString(proof),
+		Audience:  req.requester,
+		Nonce:     req.nonce,
+	})
+}
+
+// bbsProofNonce is the nonce a BBS proof is derived with, binding it to the requester and the request's nonce
+func bbsProofNonce(audience, nonce string) []byte {
+	dat, _ := json.Marshal([]string{audience, nonce})
+	return dat
+}
+
+// parseBBSKey reads the issuer's BBS public key from the JWT certifying it, without checking the JWT's signature
+func parseBBSKey(keyJWT string) (jwt.Token, *bbsg2.PublicKey, error) {
+	token, err := jwt.Parse([]byte(keyJWT), jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing BBS key JWT")
+	}
+	claim, _ := token.Get(bbsKeyClaim)
+	encoded, _ := claim.(string)
+	pubBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(pubBytes) == 0 {
+		return nil, nil, errors.Errorf("BBS key JWT of %s has no valid %s", token.Issuer(), bbsKeyClaim)
+	}
+	pub, err := bbsg2.UnmarshalPublicKey(pubBytes)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "parsing BBS key of %s", token.Issuer())
+	}
+	return token, pub, nil
+}
+
+// bbsRevealedCount is the number of messages a BBS proof reveals. The proof starts with the number of signed
+// messages and a bit vector of the revealed ones, which the verifier has to match against the messages presented:
+// VerifyProof ignores any message beyond those.
+func bbsRevealedCount(proof []byte) (int, error) {
+	if len(proof) < 2 {
+		return 0, errors.New("BBS proof is too short")
+	}
+	end := 2 + int(binary.BigEndian.Uint16(proof))/8 + 1
+	if len(proof) < end {
+		return 0, errors.New("BBS proof is too short")
+	}
+	count := 0
+	for _, b := range proof[2:end] {
+		count += bits.OnesCount8(b)
+	}
+	return count, nil
+}
+
+// VerifyBBSPresentation is VerifyPresentation for a proof derived from a BBS credential with PresentBBS. It checks:
+//  1. That the issuer's BBS key is certified by a JWT signed with a key of the issuer's DID
+//  2. The proof, for audience and the presentation's nonce, over exactly the revealed messages, and that the
+//     revealed issuer is the one whose BBS key signed them
+//  3. That the proof reveals every claim in bbsRevealedClaims, and the validity window
+//  4. The trusted issuers, the credential status and the presentation definition, as configured
+//  5. Last, that the nonce was issued by the replay cache, if one is configured
+//
+// The presented credential has the revealed claims only. Its id is derived from the proof unless the holder
+// revealed it, and Holder is empty unless the holder revealed the subject; Presentation is nil as there is no VP.
+func VerifyBBSPresentation(r resolution.Resolver, presentation []byte, audience string, opts ...VerifyOption) (*VerifiedPresentation, error) {
+	o := newVerifyOptions(opts...)
+	if r == nil {
+		return nil, errors.New("resolver cannot be empty")
+	}
+	var p BBSPresentation
+	if err := json.Unmarshal(presentation, &p); err != nil {
+		return nil, errors.Wrap(err, "parsing BBS presentation")
+	}
+	if p.Audience != audience {
+		return nil, errors.Wrapf(ErrAudienceMismatch, "expected [%s], got [%s]", audience, p.Audience)
+	}
+
+	keyToken, pub, err := parseBBSKey(p.IssuerKey)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := jws.Parse([]byte(p.IssuerKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing BBS key JWT")
+	}
+	if len(msg.Signatures()) != 1 {
+		return nil, errors.Wrapf(ErrInvalidSignature, "BBS key JWT has %d signatures, expected 1", len(msg.Signatures()))
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	if headers.Type() != bbsKeyJWTType {
+		return nil, errors.Errorf("BBS key JWT has typ<%s>, expected<%s>", headers.Type(), bbsKeyJWTType)
+	}
+	if err = verifyIssuerSignature(r, p.IssuerKey, keyToken.Issuer(), headers.KeyID(), "BBS key of "+keyToken.Issuer()); err != nil {
+		return nil, err
+	}
+
+	proof, err := base64.RawURLEncoding.DecodeString(p.Proof)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding BBS proof")
+	}
+	count, err := bbsRevealedCount(proof)
+	if err != nil {
+		return nil, err
+	}
+	if count != len(p.Messages) {
+		return nil, errors.Wrapf(ErrInvalidSignature, "BBS proof reveals %d messages, %d presented", count, len(p.Messages))
+	}
+	messages := make([][]byte, 0, len(p.Messages))
+	for _, m := range p.Messages {
+		messages = append(messages, []byte(m))
+	}
+	pubBytes, err := pub.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err = bbsg2.New().VerifyProof(messages, proof, bbsProofNonce(audience, p.Nonce), pubBytes); err != nil {
+		return nil, errors.Wrapf(ErrInvalidSignature, "BBS proof: %s", err)
+	}
+
+	claims, err := bbsClaims(p.Messages)
+	if err != nil {
+		return nil, err
+	}
+	// a proof derived without PresentBBS could otherwise hide that the credential expired or was revoked
+	for _, name := range bbsRevealedClaims {
+		if _, ok := claims[name]; !ok {
+			return nil, errors.Errorf("BBS proof does not reveal %s", name)
+		}
+	}
+	if _, ok := claims[jwt.JwtIDKey]; !ok {
+		claims[jwt.JwtIDKey] = "urn:bbs-proof:" + sdDigest(p.Proof)
+	}
+	token := jwt.New()
+	for _, k := range []string{jwt.IssuerKey, jwt.SubjectKey, jwt.JwtIDKey, jwt.NotBeforeKey, jwt.ExpirationKey} {
+		if v, ok := claims[k]; ok && v != nil {
+			if err = token.Set(k, v); err != nil {
+				return nil, errors.Wrapf(err, "setting %s", k)
+			}
+		}
+	}
+	if token.Issuer() != keyToken.Issuer() {
+		return nil, errors.Wrapf(ErrInvalidSignature, "BBS proof of credential from<%s> made with the key of %s", token.Issuer(), keyToken.Issuer())
+	}
+	if err = checkValidityWindow(token, o); err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", token.JwtID())
+	}
+	cred, err := disclosedCredential(claims, token)
+	if err != nil {
+		return nil, err
+	}
+
+	vc := VerifiedCredential{Token: token, Credential: cred}
+	if o.trusted != nil {
+		if err = o.trusted.CheckCredential(vc.Credential); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkCredentialStatus(r, vc, o); err != nil {
+		return nil, errors.Wrapf(err, "checking status of credential<%s>", vc.Credential.ID)
+	}
+	if o.definition != nil {
+		if err = checkDisclosedDefinition(*o.definition, vc, BBSFormat, bbsAlg); err != nil {
+			return nil, err
+		}
+	}
+	if err = o.redeem(p.Nonce); err != nil {
+		return nil, err
+	}
+	return &VerifiedPresentation{Holder: token.Subject(), Credentials: []VerifiedCredential{vc}}, nil
+}
+
+// bbsClaims puts the revealed messages of a BBS proof back together as claims, collecting array elements in the
+// order they were signed
+func bbsClaims(encoded []string) (map[string]any, error) {
+	claims := make(map[string]any, len(encoded))
+	elements := make(map[string]bool)
+	for i, e := range encoded {
+		var m bbsMessage
+		if err := json.Unmarshal([]byte(e), &m); err != nil {
+			return nil, errors.Wrapf(err, "parsing BBS message %d", i)
+		}
+		existing, exists := claims[m.Name]
+		if exists && (!m.Element || !elements[m.Name]) {
+			return nil, errors.Wrapf(ErrInvalidSignature, "BBS message<%s> given twice", m.Name)
+		}
+		if !m.Element {
+			claims[m.Name] = m.Value
+			continue
+		}
+		list, _ := existing.([]any)
+		claims[m.Name] = append(list, m.Value)
+		elements[m.Name] = true
+	}
+	return claims, nil
+}
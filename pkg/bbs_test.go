@@ -0,0 +1,258 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// presentTestBBS issues a BBS credential to the student and derives a proof revealing the TA role for the
+// employer, returning the presentation and the employer's replay cache
+func presentTestBBS(t *testing.T, university, student, employer *jwx.Signer) (BBSPresentation, *ReplayCache) {
+	t.Helper()
+	_, cred, err := BuildSingleBBSWithGroups(*university, university.ID, student.ID, []string{"G1", TeachingAssistantRole, "G3"})
+	if err != nil {
+		t.Fatalf("issuing BBS credential: %v", err)
+	}
+	cache := NewReplayCache()
+	req, requestVerifier := newTestRequest(t, employer, student, cache)
+	presentation, err := PresentBBS(req, requestVerifier, cred, TeachingAssistantRole)
+	if err != nil {
+		t.Fatalf("presenting BBS credential: %v", err)
+	}
+	var p BBSPresentation
+	if err = json.Unmarshal(presentation, &p); err != nil {
+		t.Fatalf("parsing BBS presentation: %v", err)
+	}
+	return p, cache
+}
+
+func marshalTestBBS(t *testing.T, p BBSPresentation) []byte {
+	t.Helper()
+	dat, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("encoding BBS presentation: %v", err)
+	}
+	return dat
+}
+
+func TestBBSRoundTrip(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	p, cache := presentTestBBS(t, university, student, employer)
+	presentation := marshalTestBBS(t, p)
+
+	verified, err := VerifyBBSPresentation(key.Resolver{}, presentation, employer.ID, WithReplayCache(cache))
+	if err != nil {
+		t.Fatalf("verifying BBS presentation: %v", err)
+	}
+	roles, _ := verified.Credentials[0].Credential.CredentialSubject["roles"].([]any)
+	if len(roles) != 1 {
+		t.Fatalf("expected only the revealed role, got %v", roles)
+	}
+	if verified.Holder != "" {
+		t.Fatalf("expected the unrevealed subject to stay hidden, got holder<%s>", verified.Holder)
+	}
+	if decision := ValidateBBSAccess(employer.ID, key.Resolver{}, presentation, TeachingAssistantPolicy(university.ID)); !decision.Allowed {
+		t.Fatalf("expected access, got %v", decision.Err())
+	}
+
+	_, err = VerifyBBSPresentation(key.Resolver{}, presentation, employer.ID, WithReplayCache(cache))
+	if !errors.Is(err, ErrPresentationReplayed) {
+		t.Fatalf("expected %v, got %v", ErrPresentationReplayed, err)
+	}
+}
+
+func TestBBSTampered(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, otherUniversity := newTestEntity(t, "Other University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	_, other := newTestEntity(t, "Other")
+	p, _ := presentTestBBS(t, university, student, employer)
+	otherP, _ := presentTestBBS(t, otherUniversity, student, employer)
+
+	tests := []struct {
+		name     string
+		tamper   func(p *BBSPresentation)
+		audience string
+		wantErr  error
+	}{
+		{
+			name:    "revealed message dropped",
+			tamper:  func(p *BBSPresentation) { p.Messages = p.Messages[:len(p.Messages)-1] },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "message added",
+			tamper:  func(p *BBSPresentation) { p.Messages = append(p.Messages, p.Messages[0]) },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "revealed role changed",
+			tamper: func(p *BBSPresentation) {
+				for i, m := range p.Messages {
+					p.Messages[i] = strings.ReplaceAll(m, TeachingAssistantRole, "Professor")
+				}
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "nonce changed",
+			tamper:  func(p *BBSPresentation) { p.Nonce = "other-nonce" },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:     "audience changed",
+			tamper:   func(p *BBSPresentation) { p.Audience = other.ID },
+			audience: other.ID,
+			wantErr:  ErrInvalidSignature,
+		},
+		{
+			name:    "issuer key of another issuer",
+			tamper:  func(p *BBSPresentation) { p.IssuerKey = otherP.IssuerKey },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:     "other audience",
+			tamper:   func(*BBSPresentation) {},
+			audience: other.ID,
+			wantErr:  ErrAudienceMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := p
+			tampered.Messages = append([]string(nil), p.Messages...)
+			tt.tamper(&tampered)
+			audience := tt.audience
+			if audience == "" {
+				audience = employer.ID
+			}
+			_, err := VerifyBBSPresentation(key.Resolver{}, marshalTestBBS(t, tampered), audience)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// deriveTestBBS derives a proof of a BBS credential like PresentBBS does, but revealing only the claims named in
+// reveal, as a holder not using PresentBBS could
+func deriveTestBBS(t *testing.T, bbsCred, audience, nonce string, reveal ...string) BBSPresentation {
+	t.Helper()
+	var cred BBSCredential
+	if err := json.Unmarshal([]byte(bbsCred), &cred); err != nil {
+		t.Fatalf("parsing BBS credential: %v", err)
+	}
+	keyToken, pub, err := parseBBSKey(cred.IssuerKey)
+	if err != nil {
+		t.Fatalf("parsing BBS key: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(cred.Signature)
+	if err != nil {
+		t.Fatalf("decoding BBS signature: %v", err)
+	}
+	var messages [][]byte
+	var revealed []int
+	var presented []string
+	for i, encoded := range cred.Messages {
+		var m bbsMessage
+		if err = json.Unmarshal([]byte(encoded), &m); err != nil {
+			t.Fatalf("parsing BBS message: %v", err)
+		}
+		messages = append(messages, []byte(encoded))
+		if util.Contains(m.Name, reveal) {
+			revealed = append(revealed, i)
+			presented = append(presented, encoded)
+		}
+	}
+	proof, err := crypto.NewBBSPlusVerifier(keyToken.Issuer(), pub).DeriveProof(messages, signature, bbsProofNonce(audience, nonce), revealed)
+	if err != nil {
+		t.Fatalf("deriving BBS proof: %v", err)
+	}
+	return BBSPresentation{
+		IssuerKey: cred.IssuerKey,
+		Messages:  presented,
+		Proof:     base64.RawURLEncoding.EncodeToString(proof),
+		Audience:  audience,
+		Nonce:     nonce,
+	}
+}
+
+func TestBBSHiddenRevealedClaims(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	validFrom := time.Now().Add(-2 * time.Hour)
+	_, cred, err := BuildSingleBBSWithGroups(*university, university.ID, student.ID, []string{TeachingAssistantRole},
+		WithValidFrom(validFrom), WithValidUntil(validFrom.Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("issuing BBS credential: %v", err)
+	}
+	all := append([]string{"roles"}, bbsRevealedClaims...)
+	if _, err = VerifyBBSPresentation(key.Resolver{}, marshalTestBBS(t, deriveTestBBS(t, cred, employer.ID, "nonce", all...)), employer.ID); !errors.Is(err, ErrCredentialExpired) {
+		t.Fatalf("expected %v, got %v", ErrCredentialExpired, err)
+	}
+
+	for _, hidden := range []string{jwt.ExpirationKey, statusClaim} {
+		t.Run("hiding "+hidden, func(t *testing.T) {
+			var reveal []string
+			for _, name := range all {
+				if name != hidden {
+					reveal = append(reveal, name)
+				}
+			}
+			p := deriveTestBBS(t, cred, employer.ID, "nonce", reveal...)
+			_, err := VerifyBBSPresentation(key.Resolver{}, marshalTestBBS(t, p), employer.ID)
+			if err == nil || !strings.Contains(err.Error(), hidden) {
+				t.Fatalf("expected the proof hiding %s to be rejected, got %v", hidden, err)
+			}
+			decision := ValidateBBSAccess(employer.ID, key.Resolver{}, marshalTestBBS(t, p), TeachingAssistantPolicy(university.ID))
+			if decision.Allowed {
+				t.Fatalf("expected no access with %s hidden", hidden)
+			}
+		})
+	}
+}
+
+func TestBBSRevealedCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		proof   []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "empty", proof: nil, wantErr: true},
+		{name: "bit vector cut short", proof: []byte{0x00, 0x10, 0xff}, wantErr: true},
+		{name: "8 messages, 3 revealed", proof: []byte{0x00, 0x08, 0b10100000, 0x01}, want: 3},
+		{name: "9 messages, none revealed", proof: []byte{0x00, 0x09, 0x00, 0x00, 0xff}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bbsRevealedCount(tt.proof)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("counting revealed messages: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d revealed messages, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/pkg/errors"
+)
+
+// ErrHolderBindingFailed is returned when a presentation is not signed by the DID its credentials were issued to
+var ErrHolderBindingFailed = errors.New("presentation is not signed by the credential subject")
+
+// verifyHolderSignature checks the VP was signed with a key of the holder DID named in its iss claim,
+// resolving the key from the kid in the VP header
+func verifyHolderSignature(r resolution.Resolver, vpJWT, holder string) error {
+	if holder == "" {
+		return errors.Wrap(ErrHolderBindingFailed, "VP has no holder")
+	}
+	msg, err := jws.Parse([]byte(vpJWT))
+	if err != nil {
+		return errors.Wrap(err, "parsing VP headers")
+	}
+	if len(msg.Signatures()) != 1 {
+		return errors.Wrapf(ErrHolderBindingFailed, "VP has %d signatures, expected 1", len(msg.Signatures()))
+	}
+	holderKID := msg.Signatures()[0].ProtectedHeaders().KeyID()
+	if holderKID == "" {
+		return errors.Wrap(ErrHolderBindingFailed, "missing kid in VP header")
+	}
+	holderDID, err := r.Resolve(context.Background(), holder)
+	if err != nil {
+		return errors.Wrapf(err, "resolving holder DID<%s>", holder)
+	}
+	holderKey, err := did.GetKeyFromVerificationMethod(holderDID.Document, holderKID)
+	if err != nil {
+		return errors.Wrapf(ErrHolderBindingFailed, "kid<%s> is not a key of holder<%s>: %s", holderKID, holder, err)
+	}
+	holderVerifier, err := jwx.NewJWXVerifier(holderDID.ID, holderKID, holderKey)
+	if err != nil {
+		return errors.Wrapf(err, "constructing verifier for holder<%s>", holder)
+	}
+	if err = holderVerifier.VerifyJWS(vpJWT); err != nil {
+		return errors.Wrapf(ErrHolderBindingFailed, "VP not signed by holder<%s>: %s", holder, err)
+	}
+	return nil
+}
+
+// subjectIDs returns the DIDs a credential was issued to: the credentialSubject id and, for membership VCs,
+// the IdentityReference id
+func subjectIDs(subject map[string]any) []string {
+	var ids []string
+	if id, ok := subject["id"].(string); ok && id != "" {
+		ids = append(ids, id)
+	}
+	if ref, ok := subject[identityReferenceClaim].(map[string]any); ok {
+		if id, ok := ref["id"].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// checkHolderBinding makes sure every presented credential was issued to the holder who signed the VP.
+// A credential without any subject id cannot be bound to a holder and is rejected.
+func checkHolderBinding(holder string, creds []VerifiedCredential) error {
+	for _, c := range creds {
+		ids := subjectIDs(c.Credential.CredentialSubject)
+		if len(ids) == 0 {
+			return errors.Wrapf(ErrHolderBindingFailed, "credential<%s> has no subject id", c.Credential.ID)
+		}
+		for _, id := range ids {
+			if id != holder {
+				return errors.Wrapf(ErrHolderBindingFailed, "credential<%s> was issued to %s, presented by %s",
+					c.Credential.ID, id, holder)
+			}
+		}
+	}
+	return nil
+}
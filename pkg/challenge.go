@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// DefaultRequestTTL is how long a presentation request, and the nonce in it, can be answered
+const DefaultRequestTTL = 5 * time.Minute
+
+var (
+	// ErrPresentationReplayed is returned for a VP whose nonce the verifier never issued or has already accepted
+	ErrPresentationReplayed = errors.New("presentation nonce is unknown or was already used")
+	// ErrChallengeExpired is returned for a VP answering a presentation request that has expired
+	ErrChallengeExpired = errors.New("presentation request has expired")
+)
+
+// PresentationChallenge is the nonce and expiry a verifier puts in a presentation request; the VP answering the
+// request has to echo the nonce before the request expires
+type PresentationChallenge struct {
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// ReplayCache keeps the nonces a verifier has handed out in presentation requests. Each nonce is accepted
+// once, and only until its request expires, so a captured submission cannot be replayed.
+type ReplayCache struct {
+	mux     sync.Mutex
+	clock   func() time.Time
+	pending map[string]time.Time // nonce -> expiry
+}
+
+// NewReplayCache creates an empty cache using the wall clock
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{
+		clock:   time.Now,
+		pending: make(map[string]time.Time),
+	}
+}
+
+// NewChallenge issues a fresh nonce valid for ttl; use DefaultRequestTTL unless there is a reason not to
+func (c *ReplayCache) NewChallenge(ttl time.Duration) PresentationChallenge {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.purge()
+	challenge := PresentationChallenge{
+		Nonce:     uuid.NewString(),
+		ExpiresAt: c.clock().Add(ttl),
+	}
+	c.pending[challenge.Nonce] = challenge.ExpiresAt
+	return challenge
+}
+
+// Redeem accepts a nonce echoed in a VP at time now. It fails with ErrPresentationReplayed for a nonce that was
+// never issued or was already redeemed, and with ErrChallengeExpired once the request it was issued in expired.
+func (c *ReplayCache) Redeem(nonce string, now time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	expiresAt, ok := c.pending[nonce]
+	if !ok {
+		return errors.Wrapf(ErrPresentationReplayed, "nonce<%s>", nonce)
+	}
+	delete(c.pending, nonce)
+	if now.After(expiresAt) {
+		return errors.Wrapf(ErrChallengeExpired, "nonce<%s> expired at %s", nonce, expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// purge forgets nonces whose requests expired a while ago, so unanswered requests do not pile up. Recently
+// expired nonces are kept so a late answer is reported as ErrChallengeExpired rather than as a replay.
+func (c *ReplayCache) purge() {
+	now := c.clock()
+	for nonce, expiresAt := range c.pending {
+		if now.After(expiresAt.Add(DefaultRequestTTL)) {
+			delete(c.pending, nonce)
+		}
+	}
+}
@@ -0,0 +1,620 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	gocrypto "crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/goccy/go-json"
+	"github.com/hyperledger/aries-framework-go/component/models/ld/context/embed"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/multiformats/go-multibase"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Ed25519Signature2020 is the Data Integrity proof type credentials and presentations are signed with by
+// IssueDataIntegrity and BuildDataIntegritySubmission
+const Ed25519Signature2020 = "Ed25519Signature2020"
+
+const (
+	// Ed25519Signature2020Context defines the terms of an Ed25519Signature2020 proof
+	Ed25519Signature2020Context = "https://w3id.org/security/suites/ed25519-2020/v1"
+	// StatusList2021Context defines the terms of a StatusList2021Entry credentialStatus
+	StatusList2021Context = "https://w3id.org/vc/status-list/2021/v1"
+	// AlumniContext defines the claims of the demo credentials; it is shipped with this package
+	AlumniContext = "https://example.edu/contexts/alumni/v1"
+
+	assertionMethodPurpose = "assertionMethod"
+	authenticationPurpose  = "authentication"
+)
+
+// DefaultLDCredentialContext is the JSON-LD context of an LD credential whose template does not set one.
+// DefaultCredentialContext is not used: the examples context it points at cannot be loaded offline.
+var DefaultLDCredentialContext = []string{"https://www.w3.org/2018/credentials/v1", AlumniContext}
+
+//go:embed contexts/alumni-v1.jsonld
+var alumniContext []byte
+
+// ldContexts are the only JSON-LD contexts documents may use; they are never fetched, so neither the issuer nor the
+// verifier depend on (or can be steered by) remote context documents
+var ldContexts = struct {
+	sync.RWMutex
+	docs map[string]any
+	err  error
+	once sync.Once
+}{docs: make(map[string]any)}
+
+// loadLDContexts loads the contexts bundled with the aries framework and the alumni context on first use
+func loadLDContexts() error {
+	ldContexts.once.Do(func() {
+		for _, c := range embed.Contexts {
+			if ldContexts.err = addLDContext(c.URL, c.Content); ldContexts.err != nil {
+				return
+			}
+		}
+		ldContexts.err = addLDContext(AlumniContext, alumniContext)
+	})
+	return ldContexts.err
+}
+
+// RegisterLDContext makes a JSON-LD context document available to LD credentials under url, for templates
+// using contexts other than the ones shipped with this package
+func RegisterLDContext(url string, doc []byte) error {
+	if err := loadLDContexts(); err != nil {
+		return err
+	}
+	return addLDContext(url, doc)
+}
+
+func addLDContext(url string, doc []byte) error {
+	parsed, err := ld.DocumentFromReader(bytes.NewReader(doc))
+	if err != nil {
+		return fmt.Errorf("parsing JSON-LD context<%s>: %w", url, err)
+	}
+	ldContexts.Lock()
+	defer ldContexts.Unlock()
+	ldContexts.docs[url] = parsed
+	return nil
+}
+
+// staticDocumentLoader serves the registered contexts and refuses anything else
+type staticDocumentLoader struct{}
+
+func (staticDocumentLoader) LoadDocument(url string) (*ld.RemoteDocument, error) {
+	ldContexts.RLock()
+	defer ldContexts.RUnlock()
+	doc, ok := ldContexts.docs[url]
+	if !ok {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, fmt.Sprintf("context<%s> is not registered", url))
+	}
+	return &ld.RemoteDocument{DocumentURL: url, Document: doc}, nil
+}
+
+// canonicalize turns a JSON-LD document into its URDNA2015 canonical N-Quads. Safe mode makes terms the context
+// does not define an error instead of silently leaving them out of what is signed. The processor's Expand and
+// Normalize drop it when copying their options, so the document is expanded with the API directly first.
+func canonicalize(doc map[string]any) ([]byte, error) {
+	if err := loadLDContexts(); err != nil {
+		return nil, err
+	}
+	opts := ld.NewJsonLdOptions("")
+	opts.ProcessingMode = ld.JsonLd_1_1
+	opts.DocumentLoader = staticDocumentLoader{}
+	opts.SafeMode = true
+	expanded, err := ld.NewJsonLdApi().Expand(ld.NewContext(nil, opts), "", doc, opts, false, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "expanding document")
+	}
+	opts.Algorithm = ld.AlgorithmURDNA2015
+	opts.Format = "application/n-quads"
+	out, err := ld.NewJsonLdProcessor().Normalize(expanded, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "canonicalizing document")
+	}
+	canonical, ok := out.(string)
+	if !ok {
+		return nil, errors.New("canonicalizing document: no N-Quads")
+	}
+	return []byte(canonical), nil
+}
+
+// DataIntegrityProof is an Ed25519Signature2020 proof embedded in a credential or presentation. The proof value
+// signs the hashes of the canonical proof options and of the canonical document without its proof.
+type DataIntegrityProof struct {
+	Type               string `json:"type"`
+	Created            string `json:"created"`
+	VerificationMethod string `json:"verificationMethod"`
+	ProofPurpose       string `json:"proofPurpose"`
+	// Challenge and Domain bind a presentation to the request it answers: its nonce and its requester
+	Challenge  string `json:"challenge,omitempty"`
+	Domain     string `json:"domain,omitempty"`
+	ProofValue string `json:"proofValue,omitempty"`
+}
+
+// dataIntegrityProofOf returns the single proof embedded in doc
+func dataIntegrityProofOf(doc map[string]any) (*DataIntegrityProof, error) {
+	maybeProof, ok := doc["proof"]
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidSignature, "document has no proof")
+	}
+	proofMap, ok := maybeProof.(map[string]any)
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidSignature, "document must have exactly one proof")
+	}
+	dat, err := json.Marshal(proofMap)
+	if err != nil {
+		return nil, err
+	}
+	var proof DataIntegrityProof
+	if err = json.Unmarshal(dat, &proof); err != nil {
+		return nil, errors.Wrapf(ErrInvalidSignature, "malformed proof: %s", err)
+	}
+	if proof.Type != Ed25519Signature2020 {
+		return nil, errors.Wrapf(ErrInvalidSignature, "unsupported proof type<%s>", proof.Type)
+	}
+	return &proof, nil
+}
+
+// dataIntegrityHash is what an Ed25519Signature2020 proof signs: the SHA-256 of the canonical proof options,
+// which carry the document's @context, followed by the SHA-256 of the canonical document without its proof
+func dataIntegrityHash(doc map[string]any, proof DataIntegrityProof) ([]byte, error) {
+	unsigned := make(map[string]any, len(doc))
+	for k, v := range doc {
+		if k != "proof" {
+			unsigned[k] = v
+		}
+	}
+	proof.ProofValue = ""
+	options, err := util.ToJSONMap(proof)
+	if err != nil {
+		return nil, err
+	}
+	options["@context"] = doc["@context"]
+
+	canonicalOptions, err := canonicalize(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "proof options")
+	}
+	canonicalDoc, err := canonicalize(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	optionsHash := sha256.Sum256(canonicalOptions)
+	docHash := sha256.Sum256(canonicalDoc)
+	return append(optionsHash[:], docHash[:]...), nil
+}
+
+// verificationMethodID is the absolute id of the signer's key in its DID document
+func verificationMethodID(signer jwx.Signer) string {
+	switch {
+	case strings.HasPrefix(signer.KID, "did:"):
+		return signer.KID
+	case strings.HasPrefix(signer.KID, "#"):
+		return signer.ID + signer.KID
+	default:
+		return signer.ID + "#" + signer.KID
+	}
+}
+
+// controllerOf returns the DID of a verification method id
+func controllerOf(verificationMethod string) string {
+	controller, _, _ := strings.Cut(verificationMethod, "#")
+	return controller
+}
+
+// addDataIntegrityProof signs doc with an Ed25519Signature2020 proof for purpose and embeds it. The document's
+// @context must define the terms of the proof.
+func addDataIntegrityProof(signer jwx.Signer, doc map[string]any, purpose, challenge, domain string) error {
+	key, ok := signer.PrivateKey.(gocrypto.Signer)
+	if !ok {
+		return fmt.Errorf("signer<%s> cannot sign with a %T", signer.ID, signer.PrivateKey)
+	}
+	if _, ok = key.Public().(ed25519.PublicKey); !ok {
+		return fmt.Errorf("%s needs an Ed25519 key, signer<%s> has a %T", Ed25519Signature2020, signer.ID, key.Public())
+	}
+	proof := DataIntegrityProof{
+		Type:               Ed25519Signature2020,
+		Created:            time.Now().UTC().Format(time.RFC3339),
+		VerificationMethod: verificationMethodID(signer),
+		ProofPurpose:       purpose,
+		Challenge:          challenge,
+		Domain:             domain,
+	}
+	hash, err := dataIntegrityHash(doc, proof)
+	if err != nil {
+		return err
+	}
+	// Ed25519 signs the message itself, which crypto.Signer takes with a zero hash
+	signature, err := key.Sign(rand.Reader, hash, gocrypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	proof.ProofValue, err = multibase.Encode(multibase.Base58BTC, signature)
+	if err != nil {
+		return err
+	}
+	doc["proof"] = proof
+	return nil
+}
+
+// verifyDataIntegrityProof checks the proof of doc was made for purpose by a key of controller's DID document
+func verifyDataIntegrityProof(r resolution.Resolver, doc map[string]any, proof DataIntegrityProof, controller, purpose string) error {
+	if proof.ProofPurpose != purpose {
+		return errors.Wrapf(ErrInvalidSignature, "proof purpose<%s>, expected<%s>", proof.ProofPurpose, purpose)
+	}
+	if controllerOf(proof.VerificationMethod) != controller {
+		return errors.Wrapf(ErrInvalidSignature, "signed by %s, which is not a key of %s", proof.VerificationMethod, controller)
+	}
+	resolved, err := r.Resolve(context.Background(), controller)
+	if err != nil {
+		return errors.Wrapf(err, "resolving DID<%s>", controller)
+	}
+	// DID documents may list their keys by fragment only, which GetKeyFromVerificationMethod also matches
+	_, fragment, _ := strings.Cut(proof.VerificationMethod, "#")
+	maybeKey, err := did.GetKeyFromVerificationMethod(resolved.Document, fragment)
+	if err != nil {
+		return errors.Wrapf(err, "getting key %s", proof.VerificationMethod)
+	}
+	key, ok := maybeKey.(ed25519.PublicKey)
+	if !ok {
+		return errors.Wrapf(ErrInvalidSignature, "%s is not an Ed25519 key", proof.VerificationMethod)
+	}
+	encoding, sig, err := multibase.Decode(proof.ProofValue)
+	if err != nil || encoding != multibase.Base58BTC {
+		return errors.Wrap(ErrInvalidSignature, "proofValue is not base58btc multibase")
+	}
+	hash, err := dataIntegrityHash(doc, proof)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, hash, sig) {
+		return errors.Wrapf(ErrInvalidSignature, "%s proof by %s", proof.ProofPurpose, proof.VerificationMethod)
+	}
+	return nil
+}
+
+// withContext returns contexts with ctx appended unless it is already there
+func withContext(contexts []string, ctx string) []string {
+	if util.Contains(ctx, contexts) {
+		return contexts
+	}
+	return append(append([]string{}, contexts...), ctx)
+}
+
+// IssuedLDCredential is the result of IssueDataIntegrity: the credential as JSON-LD with its embedded proof,
+// its id and the parsed credential
+type IssuedLDCredential struct {
+	ID         string
+	JSON       string
+	Credential *credential.VerifiableCredential
+}
+
+// IssueDataIntegrity makes a Verifiable Credential from the template for recipientDID like Issue, but keeps it
+// as JSON-LD and signs it with an embedded Ed25519Signature2020 proof instead of as a JWT.
+// Templates without a context get DefaultLDCredentialContext; the proof and status list contexts are added.
+func (i *Issuer) IssueDataIntegrity(t CredentialTemplate, recipientDID string, opts ...IssueOption) (*IssuedLDCredential, error) {
+	if len(t.Context) == 0 {
+		t.Context = DefaultLDCredentialContext
+	}
+	knownCred, err := i.newCredential(t, recipientDID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	contexts := withContext(t.Context, Ed25519Signature2020Context)
+	if knownCred.CredentialStatus != nil {
+		contexts = withContext(contexts, StatusList2021Context)
+	}
+	knownCred.Context = contexts
+
+	doc, err := util.ToJSONMap(knownCred)
+	if err != nil {
+		return nil, err
+	}
+	if err = addDataIntegrityProof(i.signer, doc, assertionMethodPurpose, "", ""); err != nil {
+		return nil, errors.Wrapf(err, "signing credential<%s>", knownCred.ID)
+	}
+	dat, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debug(string(dat))
+	var parsedCred credential.VerifiableCredential
+	if err = json.Unmarshal(dat, &parsedCred); err != nil {
+		return nil, err
+	}
+
+	example.WriteNote(fmt.Sprintf("VC with a Data Integrity proof issued from %s to %s", i.DID(), recipientDID))
+
+	return &IssuedLDCredential{
+		ID:         parsedCred.ID,
+		JSON:       string(dat),
+		Credential: &parsedCred,
+	}, nil
+}
+
+// BuildSingleLDVCWithGroups is BuildSingleVCWithGroups issuing the VC with a Data Integrity proof
+func BuildSingleLDVCWithGroups(signer jwx.Signer, universityDID, recipientDID string, groups []string, opts ...IssueOption) (credID string, cred string, err error) {
+	issuer, err := builderIssuer(signer, universityDID)
+	if err != nil {
+		return "", "", err
+	}
+	issued, err := issuer.IssueDataIntegrity(SingleVCTemplate(groups), recipientDID, opts...)
+	if err != nil {
+		return "", "", err
+	}
+	return issued.ID, issued.JSON, nil
+}
+
+// LDCredential describes a JSON-LD credential, taking its proof type from its embedded proof
+func LDCredential(cred string) (SubmissionCredential, error) {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(cred), &doc); err != nil {
+		return SubmissionCredential{}, errors.Wrap(err, "parsing LD credential")
+	}
+	proof, err := dataIntegrityProofOf(doc)
+	if err != nil {
+		return SubmissionCredential{}, err
+	}
+	return SubmissionCredential{
+		Token:  cred,
+		Format: exchange.LDPVC.String(),
+		Alg:    proof.Type,
+	}, nil
+}
+
+// LDPVCFormat accepts ldp_vc credentials with a proof of one of proofTypes, or of any type when none are given
+func LDPVCFormat(proofTypes ...cryptosuite.SignatureType) *exchange.ClaimFormat {
+	return &exchange.ClaimFormat{LDPVC: &exchange.LDPType{ProofType: proofTypes}}
+}
+
+// MakeLDPresentationData is MakePresentationData accepting only ldp_vc credentials with an Ed25519Signature2020
+// proof, the only proof VerifyDataIntegrityPresentation verifies
+func MakeLDPresentationData(id, inputID, trustedIssuer string) (exchange.PresentationDefinition, error) {
+	def, err := MakePresentationData(id, inputID, trustedIssuer)
+	if err != nil {
+		return def, err
+	}
+	def.Format = LDPVCFormat(Ed25519Signature2020)
+	return def, nil
+}
+
+// ldCredentialClaims shows an LD credential to field paths the way its JWT form would be seen: the issuer, subject
+// and id as the iss, sub and jti claims, next to the credential under vc
+func ldCredentialClaims(cred string) (map[string]any, error) {
+	var vc map[string]any
+	if err := json.Unmarshal([]byte(cred), &vc); err != nil {
+		return nil, errors.Wrap(err, "parsing LD credential")
+	}
+	claims := map[string]any{credential.VCJWTProperty: vc}
+	switch issuer := vc["issuer"].(type) {
+	case string:
+		claims[jwt.IssuerKey] = issuer
+	case map[string]any:
+		claims[jwt.IssuerKey] = issuer["id"]
+	}
+	if subject, ok := vc["credentialSubject"].(map[string]any); ok && subject["id"] != nil {
+		claims[jwt.SubjectKey] = subject["id"]
+	}
+	if id, ok := vc["id"]; ok {
+		claims[jwt.JwtIDKey] = id
+	}
+	return claims, nil
+}
+
+// BuildDataIntegritySubmission is BuildSubmission for JSON-LD credentials: the VP embeds them as JSON-LD and,
+// instead of being a JWT, carries an Ed25519Signature2020 authentication proof whose challenge is the request's
+// nonce and whose domain is the requester
+func BuildDataIntegritySubmission(presentationRequestJWT string, verifier jwx.Verifier, signer jwx.Signer, creds ...SubmissionCredential) ([]byte, error) {
+	req, err := parsePresentationRequest(presentationRequestJWT, verifier)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range creds {
+		if c.Format != exchange.LDPVC.String() {
+			return nil, fmt.Errorf("a Data Integrity presentation cannot carry a %s credential", c.Format)
+		}
+	}
+	matches, err := selectCredentials(req.definition, creds)
+	if err != nil {
+		return nil, err
+	}
+	example.WriteNote(fmt.Sprintf("Holder selected %d of %d credentials for the presentation", len(matches), len(creds)))
+
+	vp, err := submissionVP(signer.ID, *req, matches)
+	if err != nil {
+		return nil, err
+	}
+	contexts, err := util.InterfaceToStrings(vp.Context)
+	if err != nil {
+		return nil, err
+	}
+	vp.Context = withContext(contexts, Ed25519Signature2020Context)
+	// the VP id is a bare uuid, which is not an IRI
+	vp.ID = "urn:uuid:" + vp.ID
+	doc, err := util.ToJSONMap(vp)
+	if err != nil {
+		return nil, err
+	}
+	if err = addDataIntegrityProof(signer, doc, authenticationPurpose, req.nonce, req.requester); err != nil {
+		return nil, errors.Wrap(err, "signing VP")
+	}
+	return json.Marshal(doc)
+}
+
+// RespondWithDataIntegrity is RespondToPresentationRequest for the JSON-LD credentials in the wallet, answered
+// with BuildDataIntegritySubmission
+func (e *Entity) RespondWithDataIntegrity(presentationRequestJWT string, requestVerifier jwx.Verifier) ([]byte, error) {
+	signer, err := e.Signer()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := e.heldCredentials(exchange.LDPVC.String())
+	if err != nil {
+		return nil, err
+	}
+	return BuildDataIntegritySubmission(presentationRequestJWT, requestVerifier, *signer, creds...)
+}
+
+// ldCredentialToken carries the issuer, subject, id and validity window of an LD credential as JWT claims, so
+// the validity window, status and policy checks treat it like a JWT VC
+func ldCredentialToken(cred credential.VerifiableCredential) (jwt.Token, error) {
+	token := jwt.New()
+	claims := map[string]any{jwt.JwtIDKey: cred.ID}
+	switch issuer := cred.Issuer.(type) {
+	case string:
+		claims[jwt.IssuerKey] = issuer
+	case map[string]any:
+		claims[jwt.IssuerKey] = issuer["id"]
+	}
+	if id, ok := cred.CredentialSubject["id"].(string); ok {
+		claims[jwt.SubjectKey] = id
+	}
+	issued, err := time.Parse(time.RFC3339, cred.IssuanceDate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "issuanceDate of credential<%s>", cred.ID)
+	}
+	claims[jwt.NotBeforeKey] = issued
+	if cred.ExpirationDate != "" {
+		expires, err := time.Parse(time.RFC3339, cred.ExpirationDate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "expirationDate of credential<%s>", cred.ID)
+		}
+		claims[jwt.ExpirationKey] = expires
+	}
+	for k, v := range claims {
+		if err = token.Set(k, v); err != nil {
+			return nil, errors.Wrapf(err, "setting %s", k)
+		}
+	}
+	return token, nil
+}
+
+// verifyLDCredential checks an LD credential's validity window and then that its assertionMethod proof was made
+// with a key of its issuer
+func verifyLDCredential(r resolution.Resolver, doc map[string]any, o verifyOptions) (*VerifiedCredential, error) {
+	dat, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var cred credential.VerifiableCredential
+	if err = json.Unmarshal(dat, &cred); err != nil {
+		return nil, errors.Wrap(err, "parsing LD credential")
+	}
+	token, err := ldCredentialToken(cred)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkValidityWindow(token, o); err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", cred.ID)
+	}
+	proof, err := dataIntegrityProofOf(doc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", cred.ID)
+	}
+	if err = verifyDataIntegrityProof(r, doc, *proof, token.Issuer(), assertionMethodPurpose); err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", cred.ID)
+	}
+	return &VerifiedCredential{Token: token, Credential: &cred}, nil
+}
+
+// VerifyDataIntegrityPresentation is VerifyPresentation for a VP made with BuildDataIntegritySubmission. It checks:
+//  1. The VP's authentication proof was made by a key of its holder, for audience as domain
+//  2. For every LD credential, that it is inside its validity window and that its proof was made by its issuer
+//  3. Trusted issuers, status, holder binding and the presentation definition as VerifyPresentation does
+//  4. Last, that the proof's challenge is a nonce issued by the replay cache, if one is configured
+//
+// The returned Token carries the holder, audience and nonce of the VP as JWT claims.
+func VerifyDataIntegrityPresentation(r resolution.Resolver, presentation []byte, audience string, opts ...VerifyOption) (*VerifiedPresentation, error) {
+	o := newVerifyOptions(opts...)
+	if r == nil {
+		return nil, errors.New("resolver cannot be empty")
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(presentation, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing VP")
+	}
+	var vp credential.VerifiablePresentation
+	if err := json.Unmarshal(presentation, &vp); err != nil {
+		return nil, errors.Wrap(err, "parsing VP")
+	}
+	proof, err := dataIntegrityProofOf(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "VP")
+	}
+	if proof.Domain != audience {
+		return nil, errors.Wrapf(ErrAudienceMismatch, "expected [%s], got [%s]", audience, proof.Domain)
+	}
+	holder := vp.Holder
+	if holder == "" || controllerOf(proof.VerificationMethod) != holder {
+		return nil, errors.Wrapf(ErrHolderBindingFailed, "VP not signed by holder<%s>", holder)
+	}
+	if err = verifyDataIntegrityProof(r, doc, *proof, holder, authenticationPurpose); err != nil {
+		return nil, errors.Wrap(err, "VP")
+	}
+
+	token := jwt.New()
+	for k, v := range map[string]any{
+		jwt.IssuerKey:            holder,
+		jwt.AudienceKey:          []string{audience},
+		credential.NonceProperty: proof.Challenge,
+	} {
+		if err = token.Set(k, v); err != nil {
+			return nil, errors.Wrapf(err, "setting %s", k)
+		}
+	}
+
+	verified := VerifiedPresentation{Holder: holder, Token: token, Presentation: &vp}
+	for i, maybeCred := range vp.VerifiableCredential {
+		credDoc, ok := maybeCred.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("credential %d is not a JSON-LD credential", i)
+		}
+		vc, err := verifyLDCredential(r, credDoc, o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "verifying credential %d", i)
+		}
+		if o.trusted != nil {
+			if err = o.trusted.CheckCredential(vc.Credential); err != nil {
+				return nil, err
+			}
+		}
+		if err = checkCredentialStatus(r, *vc, o); err != nil {
+			return nil, errors.Wrapf(err, "checking status of credential<%s>", vc.Credential.ID)
+		}
+		verified.Credentials = append(verified.Credentials, *vc)
+	}
+	if err = checkIdentityLinks(verified.Credentials); err != nil {
+		return nil, err
+	}
+	if err = checkHolderBinding(holder, verified.Credentials); err != nil {
+		return nil, err
+	}
+	if o.definition != nil {
+		if err = checkPresentationSubmission(*o.definition, &vp, verified.Credentials); err != nil {
+			return nil, err
+		}
+	}
+	if err = o.redeem(proof.Challenge); err != nil {
+		return nil, err
+	}
+	return &verified, nil
+}
@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+)
+
+// issueTestLDCredential issues a JSON-LD credential with a Data Integrity proof to the student
+func issueTestLDCredential(t *testing.T, university, student *jwx.Signer) string {
+	t.Helper()
+	_, cred, err := BuildSingleLDVCWithGroups(*university, university.ID, student.ID, []string{"G1", TeachingAssistantRole})
+	if err != nil {
+		t.Fatalf("issuing LD credential: %v", err)
+	}
+	return cred
+}
+
+func parseTestLD(t *testing.T, dat string) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(dat), &doc); err != nil {
+		t.Fatalf("parsing JSON-LD document: %v", err)
+	}
+	return doc
+}
+
+func TestCanonicalize(t *testing.T) {
+	a := parseTestLD(t, `{"@context": ["https://www.w3.org/2018/credentials/v1"], "type": ["VerifiableCredential"], "issuer": "did:example:a", "issuanceDate": "2024-01-01T00:00:00Z"}`)
+	b := parseTestLD(t, `{"issuanceDate": "2024-01-01T00:00:00Z", "issuer": "did:example:a", "type": ["VerifiableCredential"], "@context": ["https://www.w3.org/2018/credentials/v1"]}`)
+	canonicalA, err := canonicalize(a)
+	if err != nil {
+		t.Fatalf("canonicalizing: %v", err)
+	}
+	canonicalB, err := canonicalize(b)
+	if err != nil {
+		t.Fatalf("canonicalizing: %v", err)
+	}
+	if string(canonicalA) != string(canonicalB) {
+		t.Fatalf("expected the same N-Quads whatever the key order, got\n%s\nand\n%s", canonicalA, canonicalB)
+	}
+
+	a["undefinedTerm"] = "left unsigned"
+	if _, err = canonicalize(a); err == nil {
+		t.Fatal("expected a term the context does not define to be an error")
+	}
+}
+
+func TestDataIntegrityCredential(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, other := newTestEntity(t, "Other University")
+	_, student := newTestEntity(t, "Student")
+	cred := issueTestLDCredential(t, university, student)
+	if _, err := verifyLDCredential(key.Resolver{}, parseTestLD(t, cred), newVerifyOptions()); err != nil {
+		t.Fatalf("verifying LD credential: %v", err)
+	}
+	otherCred := parseTestLD(t, issueTestLDCredential(t, other, student))
+
+	tests := []struct {
+		name    string
+		tamper  func(doc map[string]any)
+		wantErr error
+	}{
+		{
+			name: "claim changed",
+			tamper: func(doc map[string]any) {
+				doc["credentialSubject"].(map[string]any)["id"] = other.ID
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "issuer changed",
+			tamper: func(doc map[string]any) {
+				doc["issuer"] = other.ID
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "proof of another issuer",
+			tamper: func(doc map[string]any) {
+				doc["proof"] = otherCred["proof"]
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "proof purpose changed",
+			tamper: func(doc map[string]any) {
+				doc["proof"].(map[string]any)["proofPurpose"] = authenticationPurpose
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "proof value not multibase",
+			tamper: func(doc map[string]any) {
+				doc["proof"].(map[string]any)["proofValue"] = "not-multibase"
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "proof removed",
+			tamper: func(doc map[string]any) {
+				delete(doc, "proof")
+			},
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestLD(t, cred)
+			tt.tamper(doc)
+			_, err := verifyLDCredential(key.Resolver{}, doc, newVerifyOptions())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDataIntegrityPresentation(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	_, other := newTestEntity(t, "Other")
+	cred, err := LDCredential(issueTestLDCredential(t, university, student))
+	if err != nil {
+		t.Fatalf("describing LD credential: %v", err)
+	}
+	cache := NewReplayCache()
+	req, requestVerifier := newTestRequest(t, employer, student, cache)
+	presentation, err := BuildDataIntegritySubmission(req, requestVerifier, *student, cred)
+	if err != nil {
+		t.Fatalf("building Data Integrity submission: %v", err)
+	}
+
+	if _, err = VerifyDataIntegrityPresentation(key.Resolver{}, presentation, other.ID); !errors.Is(err, ErrAudienceMismatch) {
+		t.Fatalf("expected %v, got %v", ErrAudienceMismatch, err)
+	}
+	tampered := parseTestLD(t, string(presentation))
+	tampered["verifiableCredential"].([]any)[0].(map[string]any)["issuer"] = other.ID
+	tamperedDat, err := json.Marshal(tampered)
+	if err != nil {
+		t.Fatalf("encoding VP: %v", err)
+	}
+	if _, err = VerifyDataIntegrityPresentation(key.Resolver{}, tamperedDat, employer.ID); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+
+	verified, err := VerifyDataIntegrityPresentation(key.Resolver{}, presentation, employer.ID, WithReplayCache(cache))
+	if err != nil {
+		t.Fatalf("verifying Data Integrity presentation: %v", err)
+	}
+	if verified.Holder != student.ID || len(verified.Credentials) != 1 {
+		t.Fatalf("expected one credential held by %s, got %d held by %s", student.ID, len(verified.Credentials), verified.Holder)
+	}
+	_, err = VerifyDataIntegrityPresentation(key.Resolver{}, presentation, employer.ID, WithReplayCache(cache))
+	if !errors.Is(err, ErrPresentationReplayed) {
+		t.Fatalf("expected %v, got %v", ErrPresentationReplayed, err)
+	}
+}
+
+func TestDataIntegrityPresentationFormat(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	cred, err := LDCredential(issueTestLDCredential(t, university, student))
+	if err != nil {
+		t.Fatalf("describing LD credential: %v", err)
+	}
+	// the holder answers a definition without formats; the verifier turns down those it did not ask for
+	req, requestVerifier := newTestRequest(t, employer, student, NewReplayCache())
+	presentation, err := BuildDataIntegritySubmission(req, requestVerifier, *student, cred)
+	if err != nil {
+		t.Fatalf("building Data Integrity submission: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		format  *exchange.ClaimFormat
+		wantErr error
+	}{
+		{name: "ldp_vc with Ed25519Signature2020", format: LDPVCFormat(Ed25519Signature2020)},
+		{name: "ldp_vc with any proof", format: LDPVCFormat()},
+		{name: "ldp_vc with another proof", format: LDPVCFormat("JsonWebSignature2020"), wantErr: ErrSubmissionMismatch},
+		{name: "jwt_vc", format: JWTVCFormat(crypto.EdDSA), wantErr: ErrSubmissionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := exchange.PresentationDefinition{ID: "test", Format: tt.format, InputDescriptors: []exchange.InputDescriptor{{ID: "id-1"}}}
+			_, err := VerifyDataIntegrityPresentation(key.Resolver{}, presentation, employer.ID, WithPresentationDefinition(def))
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected the presentation to verify, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReasonCode classifies why access was denied
+type ReasonCode string
+
+const (
+	ReasonSignature           ReasonCode = "signature"
+	ReasonAudience            ReasonCode = "audience"
+	ReasonExpired             ReasonCode = "expired"
+	ReasonNotYetValid         ReasonCode = "not-yet-valid"
+	ReasonRevoked             ReasonCode = "revoked"
+	ReasonSuspended           ReasonCode = "suspended"
+	ReasonLinkBroken          ReasonCode = "link-broken"
+	ReasonHolderBinding       ReasonCode = "holder-binding"
+	ReasonGroupProof          ReasonCode = "group-proof"
+	ReasonSubmissionMismatch  ReasonCode = "submission-mismatch"
+	ReasonReplayed            ReasonCode = "replayed"
+	ReasonRequestExpired      ReasonCode = "request-expired"
+	ReasonIssuerUntrusted     ReasonCode = "issuer-untrusted"
+	ReasonTypeMissing         ReasonCode = "type-missing"
+	ReasonRoleMissing         ReasonCode = "role-missing"
+	ReasonClaimMismatch       ReasonCode = "claim-mismatch"
+	ReasonNoCredentials       ReasonCode = "no-credentials"
+	ReasonInvalidPolicy       ReasonCode = "invalid-policy"
+	ReasonInvalidPresentation ReasonCode = "invalid-presentation"
+)
+
+// reasonErrors maps the errors of the verification pipeline to the reason they are reported with
+var reasonErrors = []struct {
+	err  error
+	code ReasonCode
+}{
+	{ErrInvalidSignature, ReasonSignature},
+	{ErrAudienceMismatch, ReasonAudience},
+	{ErrCredentialExpired, ReasonExpired},
+	{ErrCredentialNotYetValid, ReasonNotYetValid},
+	{ErrCredentialRevoked, ReasonRevoked},
+	{ErrCredentialSuspended, ReasonSuspended},
+	{ErrIdentityLinkBroken, ReasonLinkBroken},
+	{ErrHolderBindingFailed, ReasonHolderBinding},
+	{ErrGroupProofInvalid, ReasonGroupProof},
+	{ErrIssuerUntrusted, ReasonIssuerUntrusted},
+	{ErrSubmissionMismatch, ReasonSubmissionMismatch},
+	{ErrPresentationReplayed, ReasonReplayed},
+	{ErrChallengeExpired, ReasonRequestExpired},
+}
+
+// DenialReason is one reason access was not granted
+type DenialReason struct {
+	Code ReasonCode `json:"code"`
+	// Requirement is the policy requirement that was not met, if any
+	Requirement string `json:"requirement,omitempty"`
+	// CredentialID is the credential the reason is about, if any
+	CredentialID string `json:"credentialId,omitempty"`
+	Message      string `json:"message"`
+}
+
+func (r DenialReason) String() string {
+	var b strings.Builder
+	b.WriteString(string(r.Code))
+	if r.Requirement != "" {
+		fmt.Fprintf(&b, " requirement<%s>", r.Requirement)
+	}
+	if r.CredentialID != "" {
+		fmt.Fprintf(&b, " credential<%s>", r.CredentialID)
+	}
+	b.WriteString(": ")
+	b.WriteString(r.Message)
+	return b.String()
+}
+
+// MatchedClaim is a claim of a presented credential that satisfied a policy requirement
+type MatchedClaim struct {
+	Requirement  string `json:"requirement"`
+	CredentialID string `json:"credentialId"`
+	Path         string `json:"path"`
+	Value        any    `json:"value"`
+}
+
+// AccessDecision is the verifier's answer to a Presentation Submission: whether access is granted, which
+// credentials and claims granted it, and otherwise every reason it was denied
+type AccessDecision struct {
+	Allowed bool `json:"allowed"`
+	// MatchedCredentials maps each met policy requirement to the id of the credential that met it
+	MatchedCredentials map[string]string `json:"matchedCredentials,omitempty"`
+	MatchedClaims      []MatchedClaim    `json:"matchedClaims,omitempty"`
+	Reasons            []DenialReason    `json:"reasons,omitempty"`
+}
+
+// MatchedCredentialIDs returns the sorted ids of the credentials that met the policy, without duplicates
+func (d AccessDecision) MatchedCredentialIDs() []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range d.MatchedCredentials {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// HasReason reports whether access was denied for the given reason
+func (d AccessDecision) HasReason(code ReasonCode) bool {
+	for _, r := range d.Reasons {
+		if r.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns nil when access is allowed, otherwise an ErrAccessDenied listing the reasons
+func (d AccessDecision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	reasons := make([]string, 0, len(d.Reasons))
+	for _, r := range d.Reasons {
+		reasons = append(reasons, r.String())
+	}
+	return errors.Wrap(ErrAccessDenied, strings.Join(reasons, "; "))
+}
+
+// deny records a reason and makes sure the decision is a denial
+func (d *AccessDecision) deny(reason DenialReason) {
+	d.Allowed = false
+	d.Reasons = append(d.Reasons, reason)
+}
+
+// deniedBy is the decision for a presentation that failed verification before the policy was evaluated
+func deniedBy(err error) AccessDecision {
+	code := ReasonInvalidPresentation
+	for _, re := range reasonErrors {
+		if errors.Is(err, re.err) {
+			code = re.code
+			break
+		}
+	}
+	var d AccessDecision
+	d.deny(DenialReason{Code: code, Message: err.Error()})
+	return d
+}
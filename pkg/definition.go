@@ -0,0 +1,489 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/goccy/go-json"
+	"github.com/oliveagle/jsonpath"
+)
+
+// JSON schema types a field filter can declare
+const (
+	FilterString  = "string"
+	FilterNumber  = "number"
+	FilterInteger = "integer"
+	FilterBoolean = "boolean"
+	FilterArray   = "array"
+	FilterObject  = "object"
+)
+
+// DefinitionBuilder assembles a presentation definition. Mistakes such as a malformed JSONPath or a pattern on a
+// number filter are collected along the way and reported by Build.
+type DefinitionBuilder struct {
+	def         exchange.PresentationDefinition
+	descriptors []*DescriptorBuilder
+}
+
+// NewPresentationDefinition starts a presentation definition with the given id
+func NewPresentationDefinition(id string) *DefinitionBuilder {
+	return &DefinitionBuilder{def: exchange.PresentationDefinition{ID: id}}
+}
+
+// Name sets the human readable name of the definition
+func (b *DefinitionBuilder) Name(name string) *DefinitionBuilder {
+	b.def.Name = name
+	return b
+}
+
+// Purpose says why the verifier asks for the credentials
+func (b *DefinitionBuilder) Purpose(purpose string) *DefinitionBuilder {
+	b.def.Purpose = purpose
+	return b
+}
+
+// Format restricts the claim formats of every input descriptor without a format of its own
+func (b *DefinitionBuilder) Format(format *exchange.ClaimFormat) *DefinitionBuilder {
+	b.def.Format = format
+	return b
+}
+
+// Require adds submission requirements, see AllFrom and PickFrom
+func (b *DefinitionBuilder) Require(reqs ...exchange.SubmissionRequirement) *DefinitionBuilder {
+	b.def.SubmissionRequirements = append(b.def.SubmissionRequirements, reqs...)
+	return b
+}
+
+// Descriptor adds an input descriptor
+func (b *DefinitionBuilder) Descriptor(d *DescriptorBuilder) *DefinitionBuilder {
+	b.descriptors = append(b.descriptors, d)
+	return b
+}
+
+// Build returns the definition, or every problem found in it. Only local checks are made; unlike
+// PresentationDefinition.IsValid it does not fetch the JSON schemas.
+func (b *DefinitionBuilder) Build() (exchange.PresentationDefinition, error) {
+	def := b.def
+	def.InputDescriptors = make([]exchange.InputDescriptor, 0, len(b.descriptors))
+	var problems []string
+	for _, d := range b.descriptors {
+		def.InputDescriptors = append(def.InputDescriptors, d.build())
+		problems = append(problems, d.problems()...)
+	}
+	problems = append(problems, definitionProblems(def)...)
+	if len(problems) > 0 {
+		return exchange.PresentationDefinition{}, fmt.Errorf("presentation definition<%s>: %s", def.ID, strings.Join(problems, "; "))
+	}
+	return def, nil
+}
+
+// DescriptorBuilder assembles an input descriptor for a DefinitionBuilder
+type DescriptorBuilder struct {
+	desc   exchange.InputDescriptor
+	fields []*FieldBuilder
+}
+
+// NewInputDescriptor starts an input descriptor with the given id
+func NewInputDescriptor(id string) *DescriptorBuilder {
+	return &DescriptorBuilder{desc: exchange.InputDescriptor{ID: id}}
+}
+
+// Name sets the human readable name of the descriptor
+func (d *DescriptorBuilder) Name(name string) *DescriptorBuilder {
+	d.desc.Name = name
+	return d
+}
+
+// Purpose says why the verifier asks for this credential
+func (d *DescriptorBuilder) Purpose(purpose string) *DescriptorBuilder {
+	d.desc.Purpose = purpose
+	return d
+}
+
+// Group puts the descriptor in groups that submission requirements pick from
+func (d *DescriptorBuilder) Group(groups ...string) *DescriptorBuilder {
+	d.desc.Group = append(d.desc.Group, groups...)
+	return d
+}
+
+// Format restricts the claim formats accepted for this descriptor
+func (d *DescriptorBuilder) Format(format *exchange.ClaimFormat) *DescriptorBuilder {
+	d.desc.Format = format
+	return d
+}
+
+// LimitDisclosure asks the holder to disclose only the fields of the descriptor, exchange.Required or
+// exchange.Preferred
+func (d *DescriptorBuilder) LimitDisclosure(preference exchange.Preference) *DescriptorBuilder {
+	d.constraints().LimitDisclosure = &preference
+	return d
+}
+
+// Field adds a field constraint
+func (d *DescriptorBuilder) Field(f *FieldBuilder) *DescriptorBuilder {
+	d.fields = append(d.fields, f)
+	return d
+}
+
+func (d *DescriptorBuilder) constraints() *exchange.Constraints {
+	if d.desc.Constraints == nil {
+		d.desc.Constraints = &exchange.Constraints{}
+	}
+	return d.desc.Constraints
+}
+
+func (d *DescriptorBuilder) build() exchange.InputDescriptor {
+	if len(d.fields) > 0 {
+		c := d.constraints()
+		c.Fields = make([]exchange.Field, 0, len(d.fields))
+		for _, f := range d.fields {
+			c.Fields = append(c.Fields, f.field)
+		}
+	}
+	desc := d.desc
+	if desc.Constraints != nil {
+		c := *desc.Constraints
+		desc.Constraints = &c
+	}
+	return desc
+}
+
+func (d *DescriptorBuilder) problems() []string {
+	var problems []string
+	for _, f := range d.fields {
+		for _, p := range f.problems {
+			problems = append(problems, fmt.Sprintf("input descriptor<%s> field<%s>: %s", d.desc.ID, f.field.ID, p))
+		}
+	}
+	return problems
+}
+
+// FieldBuilder assembles a field constraint: the JSONPaths to look at and the filter the value must pass
+type FieldBuilder struct {
+	field    exchange.Field
+	problems []string
+}
+
+// NewField starts a field looking at the given JSONPaths, tried in order
+func NewField(paths ...string) *FieldBuilder {
+	return &FieldBuilder{field: exchange.Field{Path: paths}}
+}
+
+// ID names the field, e.g. in errors and relational constraints
+func (f *FieldBuilder) ID(id string) *FieldBuilder {
+	f.field.ID = id
+	return f
+}
+
+// Name sets the human readable name of the field
+func (f *FieldBuilder) Name(name string) *FieldBuilder {
+	f.field.Name = name
+	return f
+}
+
+// Purpose says why the verifier needs the field
+func (f *FieldBuilder) Purpose(purpose string) *FieldBuilder {
+	f.field.Purpose = purpose
+	return f
+}
+
+// Optional marks a field the credential may lack
+func (f *FieldBuilder) Optional() *FieldBuilder {
+	f.field.Optional = true
+	return f
+}
+
+// Type sets the JSON schema type the value must have, one of the Filter constants
+func (f *FieldBuilder) Type(typ string) *FieldBuilder {
+	f.filter().Type = typ
+	return f
+}
+
+// Equals requires the value to be v; the filter type is taken from v unless set
+func (f *FieldBuilder) Equals(v any) *FieldBuilder {
+	f.typeOf(v)
+	f.filter().Const = v
+	return f
+}
+
+// OneOf requires the value to be one of values; the filter type is taken from the first value unless set
+func (f *FieldBuilder) OneOf(values ...any) *FieldBuilder {
+	if len(values) == 0 {
+		f.problems = append(f.problems, "one of needs at least one value")
+		return f
+	}
+	f.typeOf(values[0])
+	f.filter().Enum = values
+	return f
+}
+
+// Matches requires a string value matching the regular expression pattern
+func (f *FieldBuilder) Matches(pattern string) *FieldBuilder {
+	if f.filter().Type == "" {
+		f.filter().Type = FilterString
+	}
+	f.filter().Pattern = pattern
+	return f
+}
+
+// AtLeast requires a number value of at least min
+func (f *FieldBuilder) AtLeast(min float64) *FieldBuilder {
+	if f.filter().Type == "" {
+		f.filter().Type = FilterNumber
+	}
+	f.filter().Minimum = min
+	return f
+}
+
+// AtMost requires a number value of at most max
+func (f *FieldBuilder) AtMost(max float64) *FieldBuilder {
+	if f.filter().Type == "" {
+		f.filter().Type = FilterNumber
+	}
+	f.filter().Maximum = max
+	return f
+}
+
+// Filter sets a raw JSON schema filter, for what the typed methods do not cover
+func (f *FieldBuilder) Filter(filter exchange.Filter) *FieldBuilder {
+	f.field.Filter = &filter
+	return f
+}
+
+func (f *FieldBuilder) filter() *exchange.Filter {
+	if f.field.Filter == nil {
+		f.field.Filter = &exchange.Filter{}
+	}
+	return f.field.Filter
+}
+
+func (f *FieldBuilder) typeOf(v any) {
+	if f.filter().Type != "" {
+		return
+	}
+	typ, ok := jsonType(v)
+	if !ok {
+		f.problems = append(f.problems, fmt.Sprintf("value %v of type %T has no JSON type", v, v))
+		return
+	}
+	f.filter().Type = typ
+}
+
+// JWTVCFormat accepts jwt_vc credentials signed with one of algs, or with any algorithm when none are given
+func JWTVCFormat(algs ...crypto.SignatureAlgorithm) *exchange.ClaimFormat {
+	return &exchange.ClaimFormat{JWTVC: &exchange.JWTType{Alg: algs}}
+}
+
+// jsonType is the JSON schema type of a Go value
+func jsonType(v any) (string, bool) {
+	switch v.(type) {
+	case string:
+		return FilterString, true
+	case bool:
+		return FilterBoolean, true
+	case int, int32, int64, uint, uint32, uint64:
+		return FilterInteger, true
+	case float32, float64, json.Number:
+		return FilterNumber, true
+	case []any, []string:
+		return FilterArray, true
+	case map[string]any:
+		return FilterObject, true
+	}
+	return "", false
+}
+
+// valueHasType reports whether a value can pass a filter of the given JSON schema type
+func valueHasType(v any, typ string) bool {
+	actual, ok := jsonType(v)
+	if !ok {
+		return false
+	}
+	switch typ {
+	case FilterNumber:
+		return actual == FilterNumber || actual == FilterInteger
+	case FilterInteger:
+		if f, ok := toFloat(v); ok {
+			return f == float64(int64(f))
+		}
+		return false
+	}
+	return actual == typ
+}
+
+// checkPath reports what is wrong with a JSONPath, or nil
+func checkPath(path string) error {
+	if !strings.HasPrefix(path, "$") {
+		return fmt.Errorf("path<%s> must start with $", path)
+	}
+	if strings.Count(path, "[") != strings.Count(path, "]") {
+		return fmt.Errorf("path<%s> has unbalanced brackets", path)
+	}
+	if _, err := jsonpath.Compile(path); err != nil {
+		return fmt.Errorf("path<%s>: %s", path, err)
+	}
+	return nil
+}
+
+// filterProblems checks that a filter declares a known type and only uses keywords valid for it
+func filterProblems(filter exchange.Filter) []string {
+	var problems []string
+	switch filter.Type {
+	case FilterString, FilterNumber, FilterInteger, FilterBoolean, FilterArray, FilterObject:
+	case "":
+		if filter.Pattern != "" || filter.Minimum != nil || filter.Maximum != nil {
+			problems = append(problems, "filter needs a type")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("filter type<%s> is not a JSON schema type", filter.Type))
+	}
+	if filter.Pattern != "" {
+		if filter.Type != FilterString {
+			problems = append(problems, fmt.Sprintf("pattern needs a string filter, not %s", filter.Type))
+		}
+		if _, err := regexp.Compile(filter.Pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("pattern<%s>: %s", filter.Pattern, err))
+		}
+	}
+	for i, bound := range []any{filter.Minimum, filter.Maximum} {
+		name := []string{"minimum", "maximum"}[i]
+		if bound == nil {
+			continue
+		}
+		if filter.Type != FilterNumber && filter.Type != FilterInteger {
+			problems = append(problems, fmt.Sprintf("%s needs a number filter, not %s", name, filter.Type))
+		}
+		if _, ok := toFloat(bound); !ok {
+			problems = append(problems, fmt.Sprintf("%s %v is not a number", name, bound))
+		}
+	}
+	if filter.Type != "" && filter.Const != nil && !valueHasType(filter.Const, filter.Type) {
+		problems = append(problems, fmt.Sprintf("const %v is not a %s", filter.Const, filter.Type))
+	}
+	for _, v := range filter.Enum {
+		if filter.Type != "" && !valueHasType(v, filter.Type) {
+			problems = append(problems, fmt.Sprintf("enum value %v is not a %s", v, filter.Type))
+		}
+	}
+	return problems
+}
+
+// submissionRequirementProblems checks a submission requirement and the ones nested in it
+func submissionRequirementProblems(req exchange.SubmissionRequirement, groups map[string][]int) []string {
+	var problems []string
+	name := describeRequirement(req)
+	switch req.Rule {
+	case exchange.All, exchange.Pick:
+	default:
+		problems = append(problems, fmt.Sprintf("submission requirement rule<%s> must be all or pick", req.Rule))
+	}
+	if (req.From == "") == (len(req.FromNested) == 0) {
+		problems = append(problems, fmt.Sprintf("%s: needs either from or from_nested", name))
+	}
+	if req.From != "" {
+		if _, ok := groups[req.From]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: no input descriptor is in the group", name))
+		}
+	}
+	if req.Count < 0 || req.Minimum < 0 || req.Maximum < 0 {
+		problems = append(problems, fmt.Sprintf("%s: count, min and max cannot be negative", name))
+	}
+	if req.Maximum > 0 && req.Minimum > req.Maximum {
+		problems = append(problems, fmt.Sprintf("%s: min is above max", name))
+	}
+	for _, nested := range req.FromNested {
+		problems = append(problems, submissionRequirementProblems(nested, groups)...)
+	}
+	return problems
+}
+
+// definitionProblems makes the checks of Build on a whole definition, e.g. one loaded from a file
+func definitionProblems(def exchange.PresentationDefinition) []string {
+	var problems []string
+	if def.ID == "" {
+		problems = append(problems, "id is missing")
+	}
+	if len(def.InputDescriptors) == 0 {
+		problems = append(problems, "at least one input descriptor is needed")
+	}
+	if def.Format != nil && def.Format.IsEmpty() {
+		problems = append(problems, "format lists no claim format")
+	}
+	seen := make(map[string]bool)
+	for _, desc := range def.InputDescriptors {
+		where := fmt.Sprintf("input descriptor<%s>", desc.ID)
+		if desc.ID == "" {
+			problems = append(problems, "input descriptor without an id")
+		} else if seen[desc.ID] {
+			problems = append(problems, where+" is defined twice")
+		}
+		seen[desc.ID] = true
+		if desc.Format != nil && desc.Format.IsEmpty() {
+			problems = append(problems, where+": format lists no claim format")
+		}
+		if desc.Constraints == nil || len(desc.Constraints.Fields) == 0 {
+			problems = append(problems, where+": needs at least one field")
+			continue
+		}
+		if ld := desc.Constraints.LimitDisclosure; ld != nil && *ld != exchange.Required && *ld != exchange.Preferred {
+			problems = append(problems, fmt.Sprintf("%s: limit_disclosure<%s> must be required or preferred", where, *ld))
+		}
+		for _, field := range desc.Constraints.Fields {
+			fieldWhere := fmt.Sprintf("%s field<%s>", where, field.ID)
+			if len(field.Path) == 0 {
+				problems = append(problems, fieldWhere+": needs at least one path")
+			}
+			for _, path := range field.Path {
+				if err := checkPath(path); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %s", fieldWhere, err))
+				}
+			}
+			if field.Filter != nil {
+				for _, p := range filterProblems(*field.Filter) {
+					problems = append(problems, fmt.Sprintf("%s: %s", fieldWhere, p))
+				}
+			}
+		}
+	}
+	groups := groupDescriptors(def)
+	for _, req := range def.SubmissionRequirements {
+		problems = append(problems, submissionRequirementProblems(req, groups)...)
+	}
+	return problems
+}
+
+// SavePresentationDefinition writes a definition to a JSON file as {"presentation_definition": ...}
+func SavePresentationDefinition(path string, def exchange.PresentationDefinition) error {
+	dat, err := json.MarshalIndent(exchange.PresentationDefinitionEnvelope{PresentationDefinition: def}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, dat, 0o644)
+}
+
+// LoadPresentationDefinition reads a definition from a JSON file, either wrapped in "presentation_definition"
+// or bare, and makes the same checks as DefinitionBuilder.Build
+func LoadPresentationDefinition(path string) (exchange.PresentationDefinition, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return exchange.PresentationDefinition{}, err
+	}
+	var envelope exchange.PresentationDefinitionEnvelope
+	if err = json.Unmarshal(dat, &envelope); err != nil {
+		return exchange.PresentationDefinition{}, fmt.Errorf("parsing presentation definition<%s>: %w", path, err)
+	}
+	def := envelope.PresentationDefinition
+	if def.IsEmpty() {
+		if err = json.Unmarshal(dat, &def); err != nil {
+			return exchange.PresentationDefinition{}, fmt.Errorf("parsing presentation definition<%s>: %w", path, err)
+		}
+	}
+	if problems := definitionProblems(def); len(problems) > 0 {
+		return exchange.PresentationDefinition{}, fmt.Errorf("presentation definition<%s> in %s: %s", def.ID, path, strings.Join(problems, "; "))
+	}
+	return def, nil
+}
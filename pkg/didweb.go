@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/TBD54566975/ssi-sdk/did/web"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// DIDWebHost serves the DID documents of did:web DIDs on the domain of a web server, e.g. a Publisher or an
+// httptest.Server, at /<name>/did.json. Documents are served as last published, without the retired keys whose
+// grace period is over.
+type DIDWebHost struct {
+	// domain is the host and port of the server as did:web encodes it
+	domain string
+
+	mux  sync.RWMutex
+	docs map[string]PublishedDocument
+}
+
+// NewDIDWebHost makes a host for the server at baseURL, which has to route the DID document paths to it:
+//
+//	host, err := NewDIDWebHost(publisher.URL)
+//	publisher.Handle("/", host)
+func NewDIDWebHost(baseURL string) (*DIDWebHost, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing base url<%s>", baseURL)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("base url<%s> has to be the root of a server", baseURL)
+	}
+	return &DIDWebHost{domain: url.QueryEscape(u.Host), docs: make(map[string]PublishedDocument)}, nil
+}
+
+// DID returns the did:web DID the document of name is served for; names are lowercased and anything but letters
+// and digits becomes a dash, so "Example University" is did:web:<domain>:example-university
+func (h *DIDWebHost) DID(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+	return fmt.Sprintf("%s:%s:%s", web.WebPrefix, h.domain, slug)
+}
+
+// Publish replaces the served document of its DID, which has to be a DID of the host
+func (h *DIDWebHost) Publish(doc PublishedDocument) error {
+	prefix := fmt.Sprintf("%s:%s:", web.WebPrefix, h.domain)
+	if !strings.HasPrefix(doc.Document.ID, prefix) {
+		return fmt.Errorf("DID<%s> is not hosted on %s", doc.Document.ID, h.domain)
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.docs[doc.Document.ID] = doc
+	return nil
+}
+
+// hosts reports whether a document was published for id
+func (h *DIDWebHost) hosts(id string) bool {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	_, ok := h.docs[id]
+	return ok
+}
+
+// ServeHTTP serves the DID documents; /<name>/did.json is the document of DID(name)
+func (h *DIDWebHost) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/"+web.WebDIDDocFilename)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	h.mux.RLock()
+	published, ok := h.docs[fmt.Sprintf("%s:%s:%s", web.WebPrefix, h.domain, name)]
+	h.mux.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	dat, err := json.Marshal(published.current(time.Now()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/did+json")
+	_, _ = w.Write(dat)
+}
+
+// WebResolver resolves did:web DIDs by fetching their DID documents. It fetches over HTTPS, as did:web requires,
+// unless AllowHTTP is set for hosts like a local Publisher that only serve HTTP.
+type WebResolver struct {
+	// Client fetches the documents, e.g. the client of an httptest.Server serving TLS
+	Client    *http.Client
+	AllowHTTP bool
+}
+
+var _ resolution.Resolver = (*WebResolver)(nil)
+
+// Methods returns did:web
+func (WebResolver) Methods() []did.Method {
+	return []did.Method{did.WebMethod}
+}
+
+// Resolve fetches the DID document of id from the URL did:web derives from it
+func (r WebResolver) Resolve(ctx context.Context, id string, _ ...resolution.ResolutionOption) (*resolution.ResolutionResult, error) {
+	docURL, err := web.DIDWeb(id).GetDocURL()
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving did:web DID<%s>", id)
+	}
+	if r.AllowHTTP {
+		docURL = "http://" + strings.TrimPrefix(docURL, "https://")
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, docURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving did:web DID<%s>", id)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching DID document<%s>", docURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching DID document<%s>: unexpected status %s", docURL, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading DID document<%s>", docURL)
+	}
+	var doc did.Document
+	if err = json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrapf(err, "parsing DID document<%s>", docURL)
+	}
+	if doc.ID != id {
+		return nil, fmt.Errorf("DID document<%s> is of DID<%s>, not DID<%s>", docURL, doc.ID, id)
+	}
+	return &resolution.ResolutionResult{Document: doc}, nil
+}
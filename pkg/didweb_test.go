@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/goccy/go-json"
+)
+
+func TestWebResolver(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	host, err := NewDIDWebHost(srv.URL)
+	if err != nil {
+		t.Fatalf("making did:web host: %v", err)
+	}
+	university := host.DID("University")
+	if err = host.Publish(PublishedDocument{Document: did.Document{ID: university}}); err != nil {
+		t.Fatalf("publishing DID document: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", host)
+	mux.HandleFunc("/impostor/did.json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(did.Document{ID: university})
+	})
+	mux.HandleFunc("/malformed/did.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{"))
+	})
+	mux.HandleFunc("/broken/did.json", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+	srv.Config.Handler = mux
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr string
+	}{
+		{name: "hosted document", id: university},
+		{name: "document of another DID", id: host.DID("Impostor"), wantErr: "is of DID<" + university + ">"},
+		{name: "not found", id: host.DID("Unknown"), wantErr: "404"},
+		{name: "malformed document", id: host.DID("Malformed"), wantErr: "parsing DID document"},
+		{name: "server error", id: host.DID("Broken"), wantErr: "500"},
+		{name: "not a did:web DID", id: "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK", wantErr: "resolving did:web DID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := WebResolver{Client: srv.Client()}.Resolve(context.Background(), tt.id)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("resolving DID<%s>: %v", tt.id, err)
+				}
+				if resolved.Document.ID != tt.id {
+					t.Fatalf("expected the document of DID<%s>, got<%s>", tt.id, resolved.Document.ID)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDIDWebHost(t *testing.T) {
+	host, err := NewDIDWebHost("http://127.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("making did:web host: %v", err)
+	}
+	if got, want := host.DID("Example University"), "did:web:127.0.0.1%3A8080:example-university"; got != want {
+		t.Fatalf("expected DID<%s>, got<%s>", want, got)
+	}
+	if err = host.Publish(PublishedDocument{Document: did.Document{ID: "did:web:example.com:university"}}); err == nil {
+		t.Fatal("expected a DID of another domain not to be published")
+	}
+	if err = host.Publish(PublishedDocument{Document: did.Document{ID: host.DID("University")}}); err != nil {
+		t.Fatalf("publishing DID document: %v", err)
+	}
+	for _, baseURL := range []string{"127.0.0.1:8080", "http://127.0.0.1:8080/dids"} {
+		if _, err = NewDIDWebHost(baseURL); err == nil {
+			t.Fatalf("expected base url<%s> to be rejected", baseURL)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "document", method: http.MethodGet, path: "/university/did.json", wantStatus: http.StatusOK},
+		{name: "unknown name", method: http.MethodGet, path: "/unknown/did.json", wantStatus: http.StatusNotFound},
+		{name: "nested path", method: http.MethodGet, path: "/a/university/did.json", wantStatus: http.StatusNotFound},
+		{name: "other file", method: http.MethodGet, path: "/university/keys.json", wantStatus: http.StatusNotFound},
+		{name: "not a GET", method: http.MethodPost, path: "/university/did.json", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			host.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
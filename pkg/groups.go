@@ -0,0 +1,37 @@
+package pkg
+
+import "fmt"
+
+const (
+	// TeachingAssistantRole is the role the employer asks the student to prove in both cases
+	TeachingAssistantRole = "Teaching Assistant"
+	// DefaultGroupCount is the number of groups the student is part of in the demo
+	DefaultGroupCount = 20
+	// MaxGroupCount bounds GenerateGroups so a typo on the command line cannot issue millions of VCs
+	MaxGroupCount = 100000
+)
+
+// GenerateGroups returns n distinct group names for the benchmark.
+// The last group is always TeachingAssistantRole so the employer can grant access for any n.
+func GenerateGroups(n int) ([]string, error) {
+	if n < 1 || n > MaxGroupCount {
+		return nil, fmt.Errorf("group count<%d> must be between 1 and %d", n, MaxGroupCount)
+	}
+	groups := make([]string, 0, n)
+	for i := 1; i < n; i++ {
+		groups = append(groups, fmt.Sprintf("Group%d", i))
+	}
+	return append(groups, TeachingAssistantRole), nil
+}
+
+// roleClaims turns group names into the role entries used in the credential subject
+func roleClaims(groups []string) []any {
+	roles := make([]any, 0, len(groups))
+	for _, g := range groups {
+		roles = append(roles, map[string]any{
+			"value": g,
+			"lang":  "en",
+		})
+	}
+	return roles
+}
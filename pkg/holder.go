@@ -0,0 +1,449 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/TBD54566975/ssi-sdk/schema"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+// SubmissionCredential is a credential the holder can put in a presentation submission, along with the
+// format it is presented in and the algorithm (or proof type) it is signed with
+type SubmissionCredential struct {
+	// Token is the credential as it is embedded in the VP, e.g. a JWT
+	Token string
+	// Format is the claim format of the credential, e.g. jwt_vc
+	Format string
+	// Alg is the signature algorithm of the credential, e.g. EdDSA or ES256K
+	Alg string
+}
+
+// JWTCredential describes a JWT credential, taking its signature algorithm from the JWT header
+func JWTCredential(token string) (SubmissionCredential, error) {
+	msg, err := jws.Parse([]byte(token))
+	if err != nil {
+		return SubmissionCredential{}, errors.Wrap(err, "parsing credential JWT")
+	}
+	if len(msg.Signatures()) != 1 {
+		return SubmissionCredential{}, fmt.Errorf("credential JWT has %d signatures, expected 1", len(msg.Signatures()))
+	}
+	return SubmissionCredential{
+		Token:  token,
+		Format: exchange.JWTVC.String(),
+		Alg:    msg.Signatures()[0].ProtectedHeaders().Algorithm().String(),
+	}, nil
+}
+
+// JWTCredentials describes several JWT credentials, see JWTCredential
+func JWTCredentials(tokens ...string) ([]SubmissionCredential, error) {
+	creds := make([]SubmissionCredential, 0, len(tokens))
+	for _, token := range tokens {
+		cred, err := JWTCredential(token)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+	return creds, nil
+}
+
+// descriptorMatch is a credential the holder picked to fulfil an input descriptor
+type descriptorMatch struct {
+	descriptorID string
+	cred         SubmissionCredential
+}
+
+// credentialClaims returns the JWT claim set of a credential, which is what the paths of our
+// presentation definitions ($.iss, $.vc.credentialSubject...) are evaluated against
+func credentialClaims(cred string) (map[string]any, error) {
+	claim := exchange.PresentationClaim{
+		Token:     &cred,
+		JWTFormat: exchange.JWTVC.Ptr(),
+	}
+	return claim.GetClaimJSON()
+}
+
+// claims returns what the field paths of a definition are evaluated against for this credential
+func (c SubmissionCredential) claims() (map[string]any, error) {
+	switch c.Format {
+	case exchange.JWTVC.String(), exchange.JWT.String():
+		return credentialClaims(c.Token)
+	case exchange.LDPVC.String():
+		return ldCredentialClaims(c.Token)
+	default:
+		return nil, fmt.Errorf("unsupported credential format<%s>", c.Format)
+	}
+}
+
+// fieldMatches reports whether one of the field paths resolves in claims and passes the field filter.
+// A wildcard path yields several values; the field matches when any of them passes the filter.
+func fieldMatches(field exchange.Field, claims map[string]any) bool {
+	var filterJSON string
+	if field.Filter != nil {
+		f, err := field.Filter.ToJSON()
+		if err != nil {
+			return false
+		}
+		filterJSON = f
+	}
+	for _, path := range field.Path {
+		values, found := lookupPath(claims, path)
+		if !found {
+			continue
+		}
+		if filterJSON == "" {
+			return true
+		}
+		for _, v := range values {
+			if schema.IsAnyValidAgainstJSONSchema(v, filterJSON) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchesInputDescriptor reports whether a JWT credential satisfies every required field of the input descriptor
+func MatchesInputDescriptor(desc exchange.InputDescriptor, cred string) (bool, error) {
+	claims, err := credentialClaims(cred)
+	if err != nil {
+		return false, err
+	}
+	return unmatchedField(desc, claims) == nil, nil
+}
+
+// unmatchedField returns the first required field of the input descriptor which claims do not satisfy, or nil
+func unmatchedField(desc exchange.InputDescriptor, claims map[string]any) *exchange.Field {
+	if desc.Constraints == nil {
+		return nil
+	}
+	for i, field := range desc.Constraints.Fields {
+		if !field.Optional && !fieldMatches(field, claims) {
+			return &desc.Constraints.Fields[i]
+		}
+	}
+	return nil
+}
+
+// ErrUnmetInputDescriptor is returned when the holder has no credential for an input descriptor
+var ErrUnmetInputDescriptor = errors.New("no credential satisfies input descriptor")
+
+// maxSelectionSteps bounds the search for the smallest set of credentials; past it the best set found so far,
+// at worst the greedy one, is used
+const maxSelectionSteps = 100000
+
+// descriptorCandidates returns the indices of the credentials which can fulfil desc, or why none can
+func descriptorCandidates(def exchange.PresentationDefinition, desc exchange.InputDescriptor, creds []SubmissionCredential, claims []map[string]any) ([]int, string) {
+	var candidates []int
+	misses := make(map[string]int)
+	var order []string
+	miss := func(reason string) {
+		if misses[reason] == 0 {
+			order = append(order, reason)
+		}
+		misses[reason]++
+	}
+	for i, cred := range creds {
+		switch {
+		case claims[i] == nil:
+			miss(fmt.Sprintf("format<%s> cannot be evaluated", cred.Format))
+		case !formatAccepts(descriptorFormat(def, desc), cred.Format, cred.Alg):
+			miss(fmt.Sprintf("format<%s> with alg<%s> not accepted", cred.Format, cred.Alg))
+		default:
+			if field := unmatchedField(desc, claims[i]); field != nil {
+				miss(fmt.Sprintf("field<%s> %v not satisfied", field.ID, field.Path))
+				continue
+			}
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates, ""
+	}
+	if len(creds) == 0 {
+		return nil, fmt.Sprintf("input descriptor<%s>: the wallet is empty", desc.ID)
+	}
+	reasons := make([]string, 0, len(order))
+	for _, reason := range order {
+		reasons = append(reasons, fmt.Sprintf("%s by %d credential(s)", reason, misses[reason]))
+	}
+	return nil, fmt.Sprintf("input descriptor<%s>: %s", desc.ID, strings.Join(reasons, ", "))
+}
+
+// selectCredentials picks a credential for each input descriptor the holder answers, using as few distinct
+// credentials as it can. Without submission requirements every descriptor is answered; with them only the fewest
+// descriptors meeting the requirements are. Credentials which are not needed are left out of the presentation.
+// When the definition cannot be fulfilled the error lists the unmet descriptors and why the credentials did not
+// qualify.
+func selectCredentials(def exchange.PresentationDefinition, creds []SubmissionCredential) ([]descriptorMatch, error) {
+	claims := make([]map[string]any, len(creds))
+	for i, cred := range creds {
+		// credentials in formats that cannot be evaluated are skipped, not fatal
+		claims[i], _ = cred.claims()
+	}
+
+	candidates := make([][]int, len(def.InputDescriptors))
+	available := make(map[int]bool)
+	unmet := make(map[int]string)
+	for i, desc := range def.InputDescriptors {
+		c, reason := descriptorCandidates(def, desc, creds, claims)
+		if c == nil {
+			unmet[i] = reason
+			continue
+		}
+		candidates[i] = c
+		available[i] = true
+	}
+	answered, err := planSubmission(def, available, unmet)
+	if err != nil {
+		return nil, errors.Wrapf(err, "presentation definition<%s>", def.ID)
+	}
+
+	chosen := make([][]int, len(answered))
+	for i, d := range answered {
+		chosen[i] = candidates[d]
+	}
+	assignment := minimalCover(chosen)
+	matches := make([]descriptorMatch, 0, len(assignment))
+	for i, credIndex := range assignment {
+		matches = append(matches, descriptorMatch{descriptorID: def.InputDescriptors[answered[i]].ID, cred: creds[credIndex]})
+	}
+	return matches, nil
+}
+
+// minimalCover assigns one candidate to every descriptor so that as few distinct candidates as possible are
+// used. It starts from a greedy assignment and then searches, most constrained descriptor first, for a smaller one.
+func minimalCover(candidates [][]int) []int {
+	n := len(candidates)
+	best := greedyCover(candidates)
+	bestSize := distinct(best)
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(candidates[order[a]]) < len(candidates[order[b]]) })
+
+	current := make([]int, n)
+	used := make(map[int]int)
+	steps := 0
+	var search func(pos int)
+	search = func(pos int) {
+		steps++
+		if steps > maxSelectionSteps || len(used) >= bestSize {
+			return
+		}
+		if pos == n {
+			best = append([]int(nil), current...)
+			bestSize = len(used)
+			return
+		}
+		d := order[pos]
+		// credentials already in the set are tried first, they do not grow it
+		tried := make([]int, 0, len(candidates[d]))
+		for _, c := range candidates[d] {
+			if used[c] > 0 {
+				tried = append(tried, c)
+			}
+		}
+		for _, c := range candidates[d] {
+			if used[c] == 0 {
+				tried = append(tried, c)
+			}
+		}
+		for _, c := range tried {
+			current[d] = c
+			used[c]++
+			search(pos + 1)
+			if used[c]--; used[c] == 0 {
+				delete(used, c)
+			}
+		}
+	}
+	search(0)
+	return best
+}
+
+// greedyCover repeatedly takes the candidate fulfilling the most descriptors still open
+func greedyCover(candidates [][]int) []int {
+	assignment := make([]int, len(candidates))
+	open := make(map[int]bool, len(candidates))
+	for i := range candidates {
+		open[i] = true
+	}
+	for len(open) > 0 {
+		counts := make(map[int]int)
+		pick, pickCount := -1, 0
+		for d := range candidates {
+			if !open[d] {
+				continue
+			}
+			for _, c := range candidates[d] {
+				counts[c]++
+				if counts[c] > pickCount || (counts[c] == pickCount && c < pick) {
+					pick, pickCount = c, counts[c]
+				}
+			}
+		}
+		for d := range candidates {
+			if open[d] && containsIndex(candidates[d], pick) {
+				assignment[d] = pick
+				delete(open, d)
+			}
+		}
+	}
+	return assignment
+}
+
+func containsIndex(indices []int, i int) bool {
+	for _, j := range indices {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
+
+func distinct(assignment []int) int {
+	seen := make(map[int]bool)
+	for _, c := range assignment {
+		seen[c] = true
+	}
+	return len(seen)
+}
+
+// buildSubmission puts the matched credentials in a VP with a presentation_submission pointing each
+// input descriptor at its credential, and signs it as a JWT answering the request along with any extra claims
+func buildSubmission(signer jwx.Signer, req presentationRequest, matches []descriptorMatch, extra map[string]any) ([]byte, error) {
+	vp, err := submissionVP(signer.ID, req, matches)
+	if err != nil {
+		return nil, err
+	}
+	return signPresentationJWT(signer, req.requester, req.nonce, *vp, extra)
+}
+
+// submissionVP builds the unsigned VP of a submission: the matched credentials, JWTs as strings and JSON-LD
+// credentials as objects, and a presentation_submission pointing each input descriptor at its credential
+func submissionVP(holder string, req presentationRequest, matches []descriptorMatch) (*credential.VerifiablePresentation, error) {
+	builder := credential.NewVerifiablePresentationBuilder()
+	if err := builder.AddContext(exchange.PresentationSubmissionContext); err != nil {
+		return nil, err
+	}
+	if err := builder.AddType(exchange.PresentationSubmissionType); err != nil {
+		return nil, err
+	}
+	if err := builder.SetHolder(holder); err != nil {
+		return nil, err
+	}
+
+	// a credential fulfilling several descriptors is only presented once
+	index := make(map[string]int)
+	var descriptorMap []exchange.SubmissionDescriptor
+	for _, m := range matches {
+		i, seen := index[m.cred.Token]
+		if !seen {
+			i = len(index)
+			index[m.cred.Token] = i
+			var embedded any = m.cred.Token
+			if m.cred.Format == exchange.LDPVC.String() {
+				var doc map[string]any
+				if err := json.Unmarshal([]byte(m.cred.Token), &doc); err != nil {
+					return nil, errors.Wrap(err, "parsing LD credential")
+				}
+				embedded = doc
+			}
+			if err := builder.AddVerifiableCredentials(embedded); err != nil {
+				return nil, err
+			}
+		}
+		descriptorMap = append(descriptorMap, exchange.SubmissionDescriptor{
+			ID:     m.descriptorID,
+			Format: m.cred.Format,
+			Path:   fmt.Sprintf("$.verifiableCredential[%d]", i),
+		})
+	}
+
+	submission := exchange.PresentationSubmission{
+		ID:            uuid.NewString(),
+		DefinitionID:  req.definition.ID,
+		DescriptorMap: descriptorMap,
+	}
+	if err := builder.SetPresentationSubmission(submission); err != nil {
+		return nil, err
+	}
+	return builder.Build()
+}
+
+// BuildSubmission answers a presentation request with any number of credentials. Each input descriptor of
+// the request's definition is fulfilled by a credential in an accepted format and signature algorithm that
+// satisfies its fields and filters, using as few credentials as possible; credentials no descriptor needs are
+// left out. The VP is signed by signer for the requester and echoes the request's nonce.
+func BuildSubmission(presentationRequestJWT string, verifier jwx.Verifier, signer jwx.Signer, creds ...SubmissionCredential) ([]byte, error) {
+	req, err := parsePresentationRequest(presentationRequestJWT, verifier)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := selectCredentials(req.definition, creds)
+	if err != nil {
+		return nil, err
+	}
+	example.WriteNote(fmt.Sprintf("Holder selected %d of %d credentials for the presentation", len(matches), len(creds)))
+	return buildSubmission(signer, *req, matches, nil)
+}
+
+// signPresentationJWT signs a VP as a JWT for the requester, echoing the nonce of its presentation request.
+// Extra claims are signed alongside the VP; they cannot override the claims set here.
+// It follows credential.SignVerifiablePresentationJWT, which always puts a random nonce in the VP.
+func signPresentationJWT(signer jwx.Signer, requester, nonce string, vp credential.VerifiablePresentation, extra map[string]any) ([]byte, error) {
+	if vp.Proof != nil {
+		return nil, errors.New("presentation cannot have a proof")
+	}
+	t := jwt.New()
+	now := time.Now()
+	claims := map[string]any{
+		jwt.AudienceKey:          []string{requester},
+		jwt.IssuedAtKey:          now.Unix(),
+		jwt.NotBeforeKey:         now.Unix(),
+		credential.NonceProperty: nonce,
+	}
+	// the holder and id of the VP are carried by the iss and jti claims
+	if vp.Holder != "" {
+		claims[jwt.IssuerKey] = vp.Holder
+		vp.Holder = ""
+	}
+	if vp.ID != "" {
+		claims[jwt.JwtIDKey] = vp.ID
+		vp.ID = ""
+	}
+	claims[credential.VPJWTProperty] = vp
+	for k, v := range extra {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+	for k, v := range claims {
+		if err := t.Set(k, v); err != nil {
+			return nil, errors.Wrapf(err, "setting %s", k)
+		}
+	}
+
+	hdrs := jws.NewHeaders()
+	if signer.KID != "" {
+		if err := hdrs.Set(jws.KeyIDKey, signer.KID); err != nil {
+			return nil, errors.Wrap(err, "setting kid header")
+		}
+	}
+	return jwt.Sign(t, jwt.WithKey(jwa.SignatureAlgorithm(signer.ALG), signer.PrivateKey, jws.WithProtectedHeaders(hdrs)))
+}
@@ -8,253 +8,277 @@ import (
 	"github.com/TBD54566975/ssi-sdk/credential"
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	"github.com/goccy/go-json"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
-// BuildSampleIdentityVC Makes a Verifiable Credential using the VC data type using the CredentialBuilder as part of the credentials package in the ssk-sdk.
-// It creates a credential with claims of Identity VC which is the Organisation name here
-func BuildSampleIdentityVC(signer jwx.Signer, universityDID, recipientDID string) (credID string, cred string, err error) {
-	knownContext := []string{"https://www.w3.org/2018/credentials/v1",
-		"https://www.w3.org/2018/credentials/examples/v1"} // JSON-LD context statement
-	knownID := "http://example.edu/credentials/1872"
-	knownType := []string{"VerifiableCredential", "AlumniCredential"}
-	knownIssuer := universityDID
-	knownIssuanceDate := time.Now().Format(time.RFC3339)
-	knownSubject := map[string]any{
-		"id": recipientDID, // did:<method-name>:<method-specific-id>
-		"alumniOf": map[string]any{ // claims are here
-			"id": recipientDID,
-			"name": []any{
-				map[string]any{"value": "XYZ University",
-					"lang": "en",
-				},
-			},
-		},
+// Issuer signs credentials described by a CredentialTemplate as JWTs
+type Issuer struct {
+	signer jwx.Signer
+	// bbs is the issuer's BBS key, made on first use by IssueBBS
+	bbs *bbsIssuerKey
+}
+
+// IssuedCredential is the result of an issuance: the signed JWT, its id and the parsed credential
+type IssuedCredential struct {
+	ID         string
+	JWT        string
+	Credential *credential.VerifiableCredential
+}
+
+// IssueOption customises a single issuance
+type IssueOption func(*issueOptions)
+
+type issueOptions struct {
+	validFrom  time.Time
+	validUntil time.Time
+	status     *StatusRegistry
+}
+
+// WithValidFrom sets when the credential becomes valid. It is the credential's issuanceDate, which is
+// mapped to the JWT nbf (and iat) claim; defaults to the time of issuance.
+func WithValidFrom(t time.Time) IssueOption {
+	return func(o *issueOptions) {
+		o.validFrom = t
 	}
+}
 
-	// For more information on VC object, go to:
-	// https://github.com/TBD54566975/ssi-sdk/blob/main/credential/model.go
-	knownCred := credential.VerifiableCredential{
-		Context:           knownContext,
-		ID:                knownID, // credential id
-		Type:              knownType,
-		Issuer:            knownIssuer,
-		IssuanceDate:      knownIssuanceDate,
-		CredentialSubject: knownSubject,
+// WithValidUntil sets when the credential expires. It is the credential's expirationDate, which is
+// mapped to the JWT exp claim, and overrides the template's ValidFor.
+func WithValidUntil(t time.Time) IssueOption {
+	return func(o *issueOptions) {
+		o.validUntil = t
 	}
+}
 
-	if err := knownCred.IsValid(); err != nil {
-		return "", "", err
+// WithStatus gives the credential an entry in the registry's revocation and suspension lists and embeds
+// them as its credentialStatus, so it can be revoked or suspended after issuance
+func WithStatus(registry *StatusRegistry) IssueOption {
+	return func(o *issueOptions) {
+		o.status = registry
+	}
+}
+
+// NewIssuer creates an issuer signing with the given signer. The signer ID is used as the issuer DID.
+func NewIssuer(signer jwx.Signer) *Issuer {
+	return &Issuer{signer: signer}
+}
+
+// DID returns the DID credentials are issued from
+func (i *Issuer) DID() string {
+	return i.signer.ID
+}
+
+// Issue Makes a Verifiable Credential from the template for recipientDID and signs it as a JWT
+func (i *Issuer) Issue(t CredentialTemplate, recipientDID string, opts ...IssueOption) (*IssuedCredential, error) {
+	knownCred, err := i.newCredential(t, recipientDID, opts...)
+	if err != nil {
+		return nil, err
 	}
 
 	dat, err := json.Marshal(knownCred)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	logrus.Debug(string(dat))
 
 	// sign the credential as a JWT
-	signedCred, err := credential.SignVerifiableCredentialJWT(signer, knownCred)
+	signedCred, err := credential.SignVerifiableCredentialJWT(i.signer, *knownCred)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	cred = string(signedCred)
-	_, credToken, _, err := credential.ParseVerifiableCredentialFromJWT(string(signedCred))
+	_, credToken, parsedCred, err := credential.ParseVerifiableCredentialFromJWT(string(signedCred))
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	credID = credToken.JwtID()
 
-	example.WriteNote(fmt.Sprintf("VC issued from %s to %s", universityDID, recipientDID))
+	example.WriteNote(fmt.Sprintf("VC issued from %s to %s", i.DID(), recipientDID))
 
-	return credID, cred, nil
+	return &IssuedCredential{
+		ID:         credToken.JwtID(),
+		JWT:        string(signedCred),
+		Credential: parsedCred,
+	}, nil
 }
 
-// BuildCombinedVC Makes a Verifiable Credential using the VC data type using the CredentialBuilder as part of the credentials package in the ssk-sdk.
-// It creates a credential with claims of Organisation name and all the groups that User is part of here/
-// In the demo, 20 groups are added in the VC
-func BuildSingleVC(signer jwx.Signer, universityDID, recipientDID string) (credID string, cred string, err error) {
-	knownContext := []string{"https://www.w3.org/2018/credentials/v1",
-		"https://www.w3.org/2018/credentials/examples/v1"} // JSON-LD context statement
-	knownID := "http://example.edu/credentials/1872"
-	knownType := []string{"VerifiableCredential", "AlumniCredential"}
-	knownIssuer := universityDID
-	knownIssuanceDate := time.Now().Format(time.RFC3339)
-	knownSubject := map[string]any{
-		"id": recipientDID, // did:<method-name>:<method-specific-id>
-		"alumniOf": map[string]any{ // claims are here
-			"name": []any{
-				map[string]any{"value": "Example University",
-					"lang": "en",
-				},
-			},
-		},
-			"roles": []any{
-				map[string]any{"value": "Group1",
-					"lang": "en",
-				}, map[string]any{
-					"value": "Hiking Group",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group1",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group2",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group3",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group5",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group6",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group2",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group3",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Group4",
-					"lang":  "en",
-				}, map[string]any{
-					"value": "Hiking Group6",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group2",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group3",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group5",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group6",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group2",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group3",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group5",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group6",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group3",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Hiking Group5",
-					"lang":  "fr",
-				}, map[string]any{
-					"value": "Teaching Assistant",
-					"lang":  "en",
-				}, map[string]any{
-					"value": "Hiking Group3",
-					"lang":  "fr",
-				},
-			},
-		
+// newCredential fills the template in for recipientDID: id, validity window and status entries
+func (i *Issuer) newCredential(t CredentialTemplate, recipientDID string, opts ...IssueOption) (*credential.VerifiableCredential, error) {
+	if err := t.IsValid(); err != nil {
+		return nil, err
+	}
+	var o issueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	validFrom := o.validFrom
+	if validFrom.IsZero() {
+		validFrom = time.Now()
+	}
+	validUntil := o.validUntil
+	if validFor, _ := t.validity(); validUntil.IsZero() && validFor > 0 {
+		validUntil = validFrom.Add(validFor)
+	}
+	if !validUntil.IsZero() && !validUntil.After(validFrom) {
+		return nil, fmt.Errorf("validUntil<%s> must be after validFrom<%s>", validUntil.Format(time.RFC3339), validFrom.Format(time.RFC3339))
+	}
+
+	knownID := t.ID
+	if knownID == "" {
+		knownID = "urn:uuid:" + uuid.NewString()
+	}
+	// copy the claims so the template can be reused for other recipients
+	knownSubject := make(map[string]any, len(t.Subject)+1)
+	for k, v := range t.Subject {
+		knownSubject[k] = v
+	}
+	if !t.OmitSubjectID {
+		knownSubject["id"] = recipientDID // did:<method-name>:<method-specific-id>
 	}
 
 	// For more information on VC object, go to:
 	// https://github.com/TBD54566975/ssi-sdk/blob/main/credential/model.go
 	knownCred := credential.VerifiableCredential{
-		Context:           knownContext,
+		Context:           t.contexts(),
 		ID:                knownID, // credential id
-		Type:              knownType,
-		Issuer:            knownIssuer,
-		IssuanceDate:      knownIssuanceDate,
+		Type:              t.types(),
+		Issuer:            i.DID(),
+		IssuanceDate:      validFrom.Format(time.RFC3339),
 		CredentialSubject: knownSubject,
 	}
+	if !validUntil.IsZero() {
+		knownCred.ExpirationDate = validUntil.Format(time.RFC3339)
+	}
+	if o.status != nil {
+		entries, err := o.status.allocate(knownID)
+		if err != nil {
+			return nil, err
+		}
+		knownCred.CredentialStatus = entries
+	}
 
 	if err := knownCred.IsValid(); err != nil {
-		return "", "", err
+		return nil, err
 	}
+	return &knownCred, nil
+}
 
-	dat, err := json.Marshal(knownCred)
-	if err != nil {
-		return "", "", err
+// builderIssuer is the throwaway Issuer of the Build* helpers. The credentials are issued by the signer's DID, so
+// the universityDID they are given has to be that DID.
+func builderIssuer(signer jwx.Signer, universityDID string) (*Issuer, error) {
+	if universityDID != signer.ID {
+		return nil, fmt.Errorf("university DID<%s> is not the DID of the signer<%s>", universityDID, signer.ID)
 	}
-	logrus.Debug(string(dat))
+	return NewIssuer(signer), nil
+}
 
-	// sign the credential as a JWT
-	signedCred, err := credential.SignVerifiableCredentialJWT(signer, knownCred)
+// issueFromTemplate signs the template with a throwaway Issuer and returns the values the Build* helpers return
+func issueFromTemplate(signer jwx.Signer, universityDID string, t CredentialTemplate, recipientDID string, opts ...IssueOption) (credID string, cred string, err error) {
+	issuer, err := builderIssuer(signer, universityDID)
 	if err != nil {
 		return "", "", err
 	}
-	cred = string(signedCred)
-	_, credToken, _, err := credential.ParseVerifiableCredentialFromJWT(string(signedCred))
+	issued, err := issuer.Issue(t, recipientDID, opts...)
 	if err != nil {
 		return "", "", err
 	}
-	credID = credToken.JwtID()
-
-	example.WriteNote(fmt.Sprintf("VC issued from %s to %s", universityDID, recipientDID))
-
-	return credID, cred, nil
+	return issued.ID, issued.JWT, nil
 }
 
-// BuildMembershipVC  Makes a Verifiable Credential using the VC data type using the CredentialBuilder as part of the credentials package
-// It creates a credential with claims of group name that the user is part of.
-func BuildMembershipVC(signer jwx.Signer, universityDID, recipientDID string) (credID string, cred string, err error) {
-	knownContext := []string{"https://www.w3.org/2018/credentials/v1",
-		"https://www.w3.org/2018/credentials/examples/v1"} // JSON-LD context statement
-	knownID := "http://example.edu/credentials/18723"
-	knownType := []string{"VerifiableCredential", "AlumniMemberCredential"}
-	knownIssuer := universityDID
-	knownIssuanceDate := time.Now().Format(time.RFC3339)
-	knownSubject := map[string]any{
-		"IdentityReference": map[string]any{ // claims are here
-			"id": recipientDID,
-			"roles": []any{
-				map[string]any{"value": "Teaching Assistant",
-					"lang": "en",
+// IdentityTemplate is the Identity VC template: it carries the Organisation name the recipient is an alumnus of
+func IdentityTemplate(recipientDID string) CredentialTemplate {
+	return CredentialTemplate{
+		ID:   "http://example.edu/credentials/1872",
+		Type: []string{"VerifiableCredential", "AlumniCredential"},
+		Subject: map[string]any{
+			"alumniOf": map[string]any{ // claims are here
+				"id": recipientDID,
+				"name": []any{
+					map[string]any{"value": "XYZ University",
+						"lang": "en",
+					},
 				},
 			},
 		},
 	}
+}
 
-	// For more information on VC object, go to:
-	// https://github.com/TBD54566975/ssi-sdk/blob/main/credential/model.go
-	knownCred := credential.VerifiableCredential{
-		Context:           knownContext,
-		ID:                knownID,
-		Type:              knownType,
-		Issuer:            knownIssuer,
-		IssuanceDate:      knownIssuanceDate,
-		CredentialSubject: knownSubject,
+// SingleVCTemplate is the template used in Case 1: the Organisation name and all the groups the recipient is part of
+func SingleVCTemplate(groups []string) CredentialTemplate {
+	return CredentialTemplate{
+		ID:   "http://example.edu/credentials/1872",
+		Type: []string{"VerifiableCredential", "AlumniCredential"},
+		Subject: map[string]any{
+			"alumniOf": map[string]any{ // claims are here
+				"name": []any{
+					map[string]any{"value": "Example University",
+						"lang": "en",
+					},
+				},
+			},
+			"roles": roleClaims(groups),
+		},
 	}
+}
 
-	if err := knownCred.IsValid(); err != nil {
-		return "", "", err
+// MembershipTemplate is the Membership VC template: it carries the group name the recipient is part of
+// and the link to the recipient's identity VC.
+// Each membership VC gets its own id so many of them can be stored in one wallet.
+func MembershipTemplate(recipientDID string, identity IdentityLink, group string) CredentialTemplate {
+	return CredentialTemplate{
+		Type:          []string{"VerifiableCredential", "AlumniMemberCredential"},
+		OmitSubjectID: true,
+		Subject: map[string]any{
+			identityReferenceClaim: map[string]any{ // claims are here
+				"id": recipientDID,
+				identityCredentialClaim: map[string]any{
+					"id":        identity.ID,
+					"digestSRI": identity.DigestSRI,
+				},
+				"roles": roleClaims([]string{group}),
+			},
+		},
 	}
+}
 
-	dat, err := json.Marshal(knownCred)
-	if err != nil {
-		return "", "", err
-	}
-	logrus.Debug(string(dat))
+// BuildSampleIdentityVC Makes a Verifiable Credential using the VC data type using the CredentialBuilder as part of the credentials package in the ssk-sdk.
+// It creates a credential with claims of Identity VC which is the Organisation name here
+func BuildSampleIdentityVC(signer jwx.Signer, universityDID, recipientDID string, opts ...IssueOption) (credID string, cred string, err error) {
+	return issueFromTemplate(signer, universityDID, IdentityTemplate(recipientDID), recipientDID, opts...)
+}
 
-	// sign the credential as a JWT
-	signedCred, err := credential.SignVerifiableCredentialJWT(signer, knownCred)
-	if err != nil {
-		return "", "", err
-	}
-	cred = string(signedCred)
-	_, credToken, _, err := credential.ParseVerifiableCredentialFromJWT(string(signedCred))
+// BuildSingleVC Makes a Verifiable Credential using the VC data type using the CredentialBuilder as part of the credentials package in the ssk-sdk.
+// It creates a credential with claims of Organisation name and all the groups that User is part of here/
+// In the demo, DefaultGroupCount groups are added in the VC
+func BuildSingleVC(signer jwx.Signer, universityDID, recipientDID string, opts ...IssueOption) (credID string, cred string, err error) {
+	groups, err := GenerateGroups(DefaultGroupCount)
 	if err != nil {
 		return "", "", err
 	}
-	credID = credToken.JwtID()
+	return BuildSingleVCWithGroups(signer, universityDID, recipientDID, groups, opts...)
+}
 
-	example.WriteNote(fmt.Sprintf("VC issued from %s to %s", universityDID, recipientDID))
+// BuildSingleVCWithGroups is BuildSingleVC with the list of groups put in the VC chosen by the caller
+func BuildSingleVCWithGroups(signer jwx.Signer, universityDID, recipientDID string, groups []string, opts ...IssueOption) (credID string, cred string, err error) {
+	return issueFromTemplate(signer, universityDID, SingleVCTemplate(groups), recipientDID, opts...)
+}
 
-	return credID, cred, nil
+// BuildMembershipVC  Makes a Verifiable Credential using the VC data type using the CredentialBuilder as part of the credentials package
+// It creates a credential with claims of group name that the user is part of, linked to the user's identity VC.
+func BuildMembershipVC(signer jwx.Signer, universityDID, recipientDID string, identity IdentityLink, group string, opts ...IssueOption) (credID string, cred string, err error) {
+	return issueFromTemplate(signer, universityDID, MembershipTemplate(recipientDID, identity, group), recipientDID, opts...)
+}
+
+// BuildMembershipVCs issues one membership VC per group using BuildMembershipVC.
+// The returned ids and credentials are in the same order as groups.
+func BuildMembershipVCs(signer jwx.Signer, universityDID, recipientDID string, identity IdentityLink, groups []string, opts ...IssueOption) (credIDs []string, creds []string, err error) {
+	for _, group := range groups {
+		credID, cred, err := BuildMembershipVC(signer, universityDID, recipientDID, identity, group, opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("building membership vc for group<%s>: %w", group, err)
+		}
+		credIDs = append(credIDs, credID)
+		creds = append(creds, cred)
+	}
+	return credIDs, creds, nil
 }
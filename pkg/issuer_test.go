@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+)
+
+func TestBuildSingleVCUniversityDID(t *testing.T) {
+	_, privKey, err := crypto.GenerateEd25519Key()
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	signer, err := jwx.NewJWXSigner("did:example:university", "#key-1", privKey)
+	if err != nil {
+		t.Fatalf("making signer: %v", err)
+	}
+	if _, _, err = BuildSingleVC(*signer, signer.ID, "did:example:student"); err != nil {
+		t.Fatalf("building VC: %v", err)
+	}
+	if _, _, err = BuildSingleVC(*signer, "did:example:other", "did:example:student"); err == nil {
+		t.Fatal("expected a university DID other than the signer's to be rejected")
+	}
+}
@@ -0,0 +1,256 @@
+package pkg
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// KeyManager holds an entity's private keys and signs with them. Callers refer to keys by the id they are kept
+// under and only get crypto.Signers, which sign without giving out the private key.
+// PKCS11KeyManager, built with the pkcs11 build tag, keeps them on a PKCS#11 token.
+type KeyManager interface {
+	// CreateKey generates a key of type kt and returns the id it is kept under
+	CreateKey(kt crypto.KeyType) (string, error)
+	// PublicKey returns the public key kept under keyID
+	PublicKey(keyID string) (gocrypto.PublicKey, error)
+	// Signer returns a signer for the key kept under keyID
+	Signer(keyID string) (gocrypto.Signer, error)
+}
+
+// managedSigner is a crypto.Signer for a key of a KeyManager which does not expose the key
+type managedSigner struct {
+	signer gocrypto.Signer
+}
+
+func (s managedSigner) Public() gocrypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s managedSigner) Sign(rand io.Reader, digest []byte, opts gocrypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+// asSigner returns a private key as the crypto.Signer JWS signing takes; secp256k1 keys are signed with as ECDSA keys
+func asSigner(key gocrypto.PrivateKey) (gocrypto.Signer, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ecdsa.PrivateKey:
+		return &k, nil
+	case *rsa.PrivateKey:
+		return k, nil
+	case rsa.PrivateKey:
+		return &k, nil
+	case *secp256k1.PrivateKey:
+		return k.ToECDSA(), nil
+	case secp256k1.PrivateKey:
+		return k.ToECDSA(), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// isSupportedKeyType reports whether kt is one of SupportedKeyTypes
+func isSupportedKeyType(kt crypto.KeyType) bool {
+	for _, supported := range SupportedKeyTypes() {
+		if kt == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// keyTypeOf returns the type of a public key of a KeyManager
+func keyTypeOf(pubKey gocrypto.PublicKey) (crypto.KeyType, error) {
+	var kt crypto.KeyType
+	switch k := pubKey.(type) {
+	case ed25519.PublicKey:
+		kt = crypto.Ed25519
+	case *ecdsa.PublicKey:
+		// the curve names are those of the key types: P-256, P-384 and secp256k1
+		kt = crypto.KeyType(k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		kt = crypto.RSA
+	}
+	if !isSupportedKeyType(kt) {
+		return "", fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+	return kt, nil
+}
+
+// didPublicKey returns a public key of type kt as DID methods encode it: a secp256k1 key signing as an ECDSA key is
+// turned back into a secp256k1 key, which is encoded compressed
+func didPublicKey(kt crypto.KeyType, pubKey gocrypto.PublicKey) (gocrypto.PublicKey, error) {
+	ecKey, ok := pubKey.(*ecdsa.PublicKey)
+	if kt != crypto.SECP256k1 || !ok {
+		return pubKey, nil
+	}
+	var x, y secp256k1.FieldVal
+	if x.SetByteSlice(ecKey.X.Bytes()) || y.SetByteSlice(ecKey.Y.Bytes()) {
+		return nil, errors.New("secp256k1 public key coordinates overflow")
+	}
+	return *secp256k1.NewPublicKey(&x, &y), nil
+}
+
+// MemoryKeyManager keeps keys in memory for as long as the process runs
+type MemoryKeyManager struct {
+	mux  sync.RWMutex
+	keys map[string]gocrypto.PrivateKey
+}
+
+// NewMemoryKeyManager makes an empty MemoryKeyManager; it is what NewEntity uses unless WithKeyManager is given
+func NewMemoryKeyManager() *MemoryKeyManager {
+	return &MemoryKeyManager{keys: make(map[string]gocrypto.PrivateKey)}
+}
+
+// CreateKey generates a key of type kt under a new random id
+func (m *MemoryKeyManager) CreateKey(kt crypto.KeyType) (string, error) {
+	_, privKey, err := crypto.GenerateKeyByKeyType(kt)
+	if err != nil {
+		return "", errors.Wrapf(err, "generating %s key", kt)
+	}
+	if _, err = asSigner(privKey); err != nil {
+		return "", err
+	}
+	keyID := uuid.NewString()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.keys[keyID] = privKey
+	return keyID, nil
+}
+
+func (m *MemoryKeyManager) signer(keyID string) (gocrypto.Signer, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	key, ok := m.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key<%s> not found", keyID)
+	}
+	return asSigner(key)
+}
+
+// PublicKey returns the public key kept under keyID
+func (m *MemoryKeyManager) PublicKey(keyID string) (gocrypto.PublicKey, error) {
+	signer, err := m.signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// Signer returns a signer for the key kept under keyID
+func (m *MemoryKeyManager) Signer(keyID string) (gocrypto.Signer, error) {
+	signer, err := m.signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return managedSigner{signer: signer}, nil
+}
+
+// FileKeyManager is a MemoryKeyManager whose keys are also kept, as JWKs, in a file encrypted like a
+// FileWalletStore. Every new key is saved before it is used.
+type FileKeyManager struct {
+	*MemoryKeyManager
+	file *encryptedFile
+}
+
+// NewFileKeyManager opens the key file at path, which is made on the first CreateKey if it does not exist.
+// A wrong passphrase is ErrWalletLocked.
+func NewFileKeyManager(path, passphrase string) (*FileKeyManager, error) {
+	file, err := newEncryptedFile(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	m := FileKeyManager{MemoryKeyManager: NewMemoryKeyManager(), file: file}
+	dat, err := file.read()
+	if err != nil || dat == nil {
+		return &m, err
+	}
+	var stored map[string]jwx.PrivateKeyJWK
+	if err = json.Unmarshal(dat, &stored); err != nil {
+		return nil, fmt.Errorf("parsing key file<%s>: %w", path, err)
+	}
+	for keyID, jwk := range stored {
+		key, err := jwk.ToPrivateKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "restoring key<%s>", keyID)
+		}
+		m.keys[keyID] = key
+	}
+	return &m, nil
+}
+
+// CreateKey generates a key of type kt under a new random id and saves it
+func (m *FileKeyManager) CreateKey(kt crypto.KeyType) (string, error) {
+	keyID, err := m.MemoryKeyManager.CreateKey(kt)
+	if err != nil {
+		return "", err
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	stored := make(map[string]jwx.PrivateKeyJWK, len(m.keys))
+	for id, key := range m.keys {
+		_, jwk, err := jwx.PrivateKeyToPrivateKeyJWK(id, key)
+		if err != nil {
+			delete(m.keys, keyID)
+			return "", errors.Wrapf(err, "converting key<%s>", id)
+		}
+		stored[id] = *jwk
+	}
+	dat, err := json.Marshal(stored)
+	if err == nil {
+		err = m.file.write(dat)
+	}
+	if err != nil {
+		delete(m.keys, keyID)
+		return "", errors.Wrap(err, "saving keys")
+	}
+	return keyID, nil
+}
+
+// managedJWXSigner makes a jwx.Signer for DID id and key kid that signs with a KeyManager key. Its JWK only
+// carries the public key.
+func managedJWXSigner(km KeyManager, id, kid, keyID string) (*jwx.Signer, error) {
+	signer, err := km.Signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	pubJWK, err := jwx.PublicKeyToPublicKeyJWK(kid, signer.Public())
+	if err != nil {
+		return nil, errors.Wrapf(err, "converting public key of key<%s>", kid)
+	}
+	alg := pubJWK.ALG
+	if alg == "" {
+		if alg, err = jwx.AlgFromKeyAndCurve(pubJWK.KTY, pubJWK.CRV); err != nil {
+			return nil, errors.Wrapf(err, "getting alg of key<%s>", kid)
+		}
+	}
+	return &jwx.Signer{
+		ID: id,
+		PrivateKeyJWK: jwx.PrivateKeyJWK{
+			KTY: pubJWK.KTY,
+			CRV: pubJWK.CRV,
+			X:   pubJWK.X,
+			Y:   pubJWK.Y,
+			N:   pubJWK.N,
+			E:   pubJWK.E,
+			ALG: alg,
+			KID: kid,
+		},
+		PrivateKey: signer,
+	}, nil
+}
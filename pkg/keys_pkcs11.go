@@ -0,0 +1,94 @@
+//go:build pkcs11
+
+package pkg
+
+import (
+	gocrypto "crypto"
+	"crypto/elliptic"
+	"fmt"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/ThalesIgnite/crypto11"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// pkcs11RSABits is the size of the RSA keys PKCS11KeyManager generates, that of the keys the other managers make
+const pkcs11RSABits = 2048
+
+// PKCS11KeyManager keeps keys on a PKCS#11 token, e.g. a SoftHSM token or an HSM, which signs with them without
+// the private keys ever leaving it. Keys are generated with their id as CKA_ID and CKA_LABEL, so a manager opened
+// on the same token later finds them again. Tokens generate P-256, P-384 and RSA keys; Ed25519 and secp256k1 keys
+// are not supported.
+type PKCS11KeyManager struct {
+	ctx *crypto11.Context
+}
+
+var _ KeyManager = (*PKCS11KeyManager)(nil)
+
+// NewPKCS11KeyManager logs into the token config names with the PKCS#11 module at config.Path:
+//
+//	km, err := NewPKCS11KeyManager(&crypto11.Config{Path: "/usr/lib/softhsm/libsofthsm2.so", TokenLabel: "emp", Pin: "1234"})
+//
+// The manager holds sessions on the token until it is closed.
+func NewPKCS11KeyManager(config *crypto11.Config) (*PKCS11KeyManager, error) {
+	ctx, err := crypto11.Configure(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening PKCS#11 token<%s> with module<%s>", config.TokenLabel, config.Path)
+	}
+	return &PKCS11KeyManager{ctx: ctx}, nil
+}
+
+// Close logs out of the token and closes its sessions
+func (m *PKCS11KeyManager) Close() error {
+	return m.ctx.Close()
+}
+
+// CreateKey generates a key of type kt on the token under a new random id
+func (m *PKCS11KeyManager) CreateKey(kt crypto.KeyType) (string, error) {
+	keyID := uuid.NewString()
+	var err error
+	switch kt {
+	case crypto.P256:
+		_, err = m.ctx.GenerateECDSAKeyPairWithLabel([]byte(keyID), []byte(keyID), elliptic.P256())
+	case crypto.P384:
+		_, err = m.ctx.GenerateECDSAKeyPairWithLabel([]byte(keyID), []byte(keyID), elliptic.P384())
+	case crypto.RSA:
+		_, err = m.ctx.GenerateRSAKeyPairWithLabel([]byte(keyID), []byte(keyID), pkcs11RSABits)
+	default:
+		return "", fmt.Errorf("PKCS#11 tokens cannot generate %s keys", kt)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "generating %s key on PKCS#11 token", kt)
+	}
+	return keyID, nil
+}
+
+func (m *PKCS11KeyManager) signer(keyID string) (gocrypto.Signer, error) {
+	signer, err := m.ctx.FindKeyPair([]byte(keyID), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding key<%s> on PKCS#11 token", keyID)
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("key<%s> not found", keyID)
+	}
+	return signer, nil
+}
+
+// PublicKey returns the public key kept under keyID
+func (m *PKCS11KeyManager) PublicKey(keyID string) (gocrypto.PublicKey, error) {
+	signer, err := m.signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// Signer returns a signer for the key kept under keyID, which signs on the token
+func (m *PKCS11KeyManager) Signer(keyID string) (gocrypto.Signer, error) {
+	signer, err := m.signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return managedSigner{signer: signer}, nil
+}
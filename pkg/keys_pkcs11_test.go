@@ -0,0 +1,82 @@
+//go:build pkcs11
+
+package pkg
+
+import (
+	gocrypto "crypto"
+	"os"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// newTestPKCS11KeyManager opens the token named by EMP_PKCS11_MODULE, EMP_PKCS11_TOKEN and EMP_PKCS11_PIN, e.g. a
+// SoftHSM token made with softhsm2-util --init-token --free --label emp --pin 1234 --so-pin 1234
+func newTestPKCS11KeyManager(t *testing.T) *PKCS11KeyManager {
+	t.Helper()
+	module := os.Getenv("EMP_PKCS11_MODULE")
+	if module == "" {
+		t.Skip("EMP_PKCS11_MODULE is not set")
+	}
+	km, err := NewPKCS11KeyManager(&crypto11.Config{
+		Path:       module,
+		TokenLabel: os.Getenv("EMP_PKCS11_TOKEN"),
+		Pin:        os.Getenv("EMP_PKCS11_PIN"),
+	})
+	if err != nil {
+		t.Fatalf("opening PKCS#11 token: %v", err)
+	}
+	return km
+}
+
+func TestPKCS11KeyManager(t *testing.T) {
+	km := newTestPKCS11KeyManager(t)
+	for _, kt := range []crypto.KeyType{crypto.P256, crypto.P384, crypto.RSA} {
+		t.Run(string(kt), func(t *testing.T) {
+			university, err := NewEntity("University", did.KeyMethod, WithKeyManager(km), WithKeyType(kt))
+			if err != nil {
+				t.Fatalf("making entity: %v", err)
+			}
+			signer, err := university.Signer()
+			if err != nil {
+				t.Fatalf("getting signer: %v", err)
+			}
+			_, student := newTestEntity(t, "Student")
+			cred := issueTestJWT(t, signer, student)
+			if _, err = verifyCredentialJWT(key.Resolver{}, cred, newVerifyOptions()); err != nil {
+				t.Fatalf("verifying credential signed on the token: %v", err)
+			}
+		})
+	}
+
+	keyID, err := km.CreateKey(crypto.P256)
+	if err != nil {
+		t.Fatalf("creating key: %v", err)
+	}
+	pubKey, err := km.PublicKey(keyID)
+	if err != nil {
+		t.Fatalf("getting public key: %v", err)
+	}
+	if err = km.Close(); err != nil {
+		t.Fatalf("closing token: %v", err)
+	}
+	reopened := newTestPKCS11KeyManager(t)
+	defer reopened.Close()
+	reopenedKey, err := reopened.PublicKey(keyID)
+	if err != nil {
+		t.Fatalf("expected the key to be found on the token again, got %v", err)
+	}
+	if kt, err := keyTypeOf(reopenedKey); err != nil || kt != crypto.P256 || !pubKey.(interface{ Equal(gocrypto.PublicKey) bool }).Equal(reopenedKey) {
+		t.Fatalf("expected the same P-256 key, got %s, %v", kt, err)
+	}
+
+	if _, err = reopened.CreateKey(crypto.Ed25519); err == nil {
+		t.Fatal("expected Ed25519 keys to be rejected")
+	}
+	if _, err = reopened.Signer("missing"); err == nil {
+		t.Fatal("expected a missing key not to be found")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !jwx_es256k
+
+package pkg
+
+import "github.com/TBD54566975/ssi-sdk/crypto"
+
+// SupportedKeyTypes are the key types an entity's DID can have. secp256k1 is added when built with the jwx_es256k
+// build tag, without which ES256K JWTs cannot be signed.
+func SupportedKeyTypes() []crypto.KeyType {
+	return []crypto.KeyType{crypto.Ed25519, crypto.P256, crypto.P384, crypto.RSA}
+}
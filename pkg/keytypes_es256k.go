@@ -0,0 +1,10 @@
+//go:build jwx_es256k
+
+package pkg
+
+import "github.com/TBD54566975/ssi-sdk/crypto"
+
+// SupportedKeyTypes are the key types an entity's DID can have; secp256k1 keys sign ES256K JWTs.
+func SupportedKeyTypes() []crypto.KeyType {
+	return []crypto.KeyType{crypto.Ed25519, crypto.SECP256k1, crypto.P256, crypto.P384, crypto.RSA}
+}
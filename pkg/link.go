@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+const (
+	// identityReferenceClaim is the subject claim membership VCs use to point at the holder and their identity VC
+	identityReferenceClaim = "IdentityReference"
+	// identityCredentialClaim holds the IdentityLink inside identityReferenceClaim
+	identityCredentialClaim = "identityCredential"
+)
+
+// ErrIdentityLinkBroken is returned when a membership VC does not reference the identity VC presented with it
+var ErrIdentityLinkBroken = errors.New("membership credential is not linked to a presented identity credential")
+
+// IdentityLink ties a membership VC to one identity VC: the identity VC's id and a digest of the exact JWT
+// that was issued, so a membership VC cannot be presented alongside a different identity VC
+type IdentityLink struct {
+	ID        string `json:"id"`
+	DigestSRI string `json:"digestSRI"`
+}
+
+// NewIdentityLink builds the link to the identity VC with the given id and JWT
+func NewIdentityLink(credID, credJWT string) IdentityLink {
+	return IdentityLink{
+		ID:        credID,
+		DigestSRI: digestSRI(credJWT),
+	}
+}
+
+// digestSRI is the subresource integrity digest (sha256-<base64>) of a credential JWT
+func digestSRI(credJWT string) string {
+	sum := sha256.Sum256([]byte(credJWT))
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// identityLinkOf returns the IdentityLink embedded in a membership credential subject, or nil if the
+// subject is not a membership (it has no IdentityReference claim)
+func identityLinkOf(subject map[string]any) (*IdentityLink, error) {
+	ref, ok := subject[identityReferenceClaim]
+	if !ok {
+		return nil, nil
+	}
+	refMap, ok := ref.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s claim is not an object", identityReferenceClaim)
+	}
+	maybeLink, ok := refMap[identityCredentialClaim]
+	if !ok {
+		return nil, errors.Wrapf(ErrIdentityLinkBroken, "no %s in %s", identityCredentialClaim, identityReferenceClaim)
+	}
+	dat, err := json.Marshal(maybeLink)
+	if err != nil {
+		return nil, err
+	}
+	var link IdentityLink
+	if err = json.Unmarshal(dat, &link); err != nil {
+		return nil, errors.Wrapf(ErrIdentityLinkBroken, "malformed %s: %s", identityCredentialClaim, err)
+	}
+	if link.ID == "" || link.DigestSRI == "" {
+		return nil, errors.Wrapf(ErrIdentityLinkBroken, "incomplete %s", identityCredentialClaim)
+	}
+	return &link, nil
+}
+
+// checkIdentityLinks makes sure every membership VC in a presentation references, by id and digest, an
+// identity VC presented alongside it
+func checkIdentityLinks(creds []VerifiedCredential) error {
+	presented := make(map[string]string, len(creds))
+	for _, c := range creds {
+		presented[c.Credential.ID] = c.JWT
+	}
+	for _, c := range creds {
+		link, err := identityLinkOf(c.Credential.CredentialSubject)
+		if err != nil {
+			return errors.Wrapf(err, "credential<%s>", c.Credential.ID)
+		}
+		if link == nil {
+			continue
+		}
+		identityJWT, ok := presented[link.ID]
+		if !ok || link.ID == c.Credential.ID {
+			return errors.Wrapf(ErrIdentityLinkBroken, "credential<%s> references identity credential<%s> which was not presented",
+				c.Credential.ID, link.ID)
+		}
+		if digestSRI(identityJWT) != link.DigestSRI {
+			return errors.Wrapf(ErrIdentityLinkBroken, "credential<%s> references a different version of identity credential<%s>",
+				c.Credential.ID, link.ID)
+		}
+	}
+	return nil
+}
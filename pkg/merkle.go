@@ -0,0 +1,363 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// ErrGroupProofInvalid is returned when a group membership proof does not lead to the root committed to in the
+// credential it refers to
+var ErrGroupProofInvalid = errors.New("group membership proof does not match the commitment")
+
+const (
+	// GroupCommitmentType is the type of the groupCommitment claim: a SHA-256 Merkle tree over salted groups
+	GroupCommitmentType = "MerkleTreeSHA256"
+	// groupCommitmentClaim is the subject claim holding the Merkle root
+	groupCommitmentClaim = "groupCommitment"
+	// groupProofsClaim is the VP JWT claim carrying the holder's group membership proofs
+	groupProofsClaim = "groupProofs"
+)
+
+// Domain separation of the tree's hashes, so a leaf can never be taken for an inner node or the other way round
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// GroupOpening is a group committed to in a group commitment VC and the salt hiding it. The holder keeps the
+// openings of its commitment; without them the root gives nothing away, not even for guessable group names.
+type GroupOpening struct {
+	Group string `json:"group"`
+	Salt  string `json:"salt"`
+}
+
+// leaf is the hash of the opening at the bottom of the tree
+func (o GroupOpening) leaf() []byte {
+	dat, _ := json.Marshal([]string{o.Salt, o.Group})
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(dat)
+	return h.Sum(nil)
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// MerkleStep is one step of a membership proof: the sibling hash and whether it is on the left
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left,omitempty"`
+}
+
+// GroupProof proves that Group, hidden by Salt, is one of the groups committed to in credential Credential.
+// Path goes from the leaf up to the root.
+type GroupProof struct {
+	Credential string       `json:"credential"`
+	Group      string       `json:"group"`
+	Salt       string       `json:"salt"`
+	Path       []MerkleStep `json:"path"`
+}
+
+// Root recomputes the Merkle root the proof leads to
+func (p GroupProof) Root() (string, error) {
+	hash := GroupOpening{Group: p.Group, Salt: p.Salt}.leaf()
+	for i, step := range p.Path {
+		sibling, err := base64.RawURLEncoding.DecodeString(step.Hash)
+		if err != nil || len(sibling) != sha256.Size {
+			return "", fmt.Errorf("step %d of the proof for group<%s> is not a SHA-256 hash", i, p.Group)
+		}
+		if step.Left {
+			hash = merkleNode(sibling, hash)
+		} else {
+			hash = merkleNode(hash, sibling)
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(hash), nil
+}
+
+// Verify checks the proof leads to root
+func (p GroupProof) Verify(root string) error {
+	got, err := p.Root()
+	if err != nil {
+		return errors.Wrap(ErrGroupProofInvalid, err.Error())
+	}
+	if got != root {
+		return errors.Wrapf(ErrGroupProofInvalid, "group<%s> of credential<%s>", p.Group, p.Credential)
+	}
+	return nil
+}
+
+// GroupCommitment is a Merkle tree over salted groups. The leaves are ordered by hash, so a proof's path says
+// nothing about where the group was in the list. A node without a sibling is carried up to the next level as is.
+type GroupCommitment struct {
+	Openings []GroupOpening
+	// levels[0] are the leaves, the last level is the root
+	levels [][][]byte
+}
+
+// NewGroupCommitment salts every group and builds the tree over them
+func NewGroupCommitment(groups []string) (*GroupCommitment, error) {
+	openings := make([]GroupOpening, 0, len(groups))
+	for _, group := range groups {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		openings = append(openings, GroupOpening{Group: group, Salt: base64.RawURLEncoding.EncodeToString(salt)})
+	}
+	return OpenGroupCommitment(openings)
+}
+
+// OpenGroupCommitment rebuilds the tree from the openings the issuer handed out, which is how the holder's wallet
+// makes proofs
+func OpenGroupCommitment(openings []GroupOpening) (*GroupCommitment, error) {
+	if len(openings) == 0 {
+		return nil, errors.New("group commitment needs at least one group")
+	}
+	seen := make(map[string]bool, len(openings))
+	for _, o := range openings {
+		if seen[o.Group] {
+			return nil, fmt.Errorf("group<%s> is committed to twice", o.Group)
+		}
+		seen[o.Group] = true
+	}
+	sorted := append([]GroupOpening(nil), openings...)
+	leaves := make([][]byte, len(sorted))
+	for i, o := range sorted {
+		leaves[i] = o.leaf()
+	}
+	sort.Sort(byLeaf{sorted, leaves})
+
+	c := GroupCommitment{Openings: sorted, levels: [][][]byte{leaves}}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		c.levels = append(c.levels, next)
+		level = next
+	}
+	return &c, nil
+}
+
+// byLeaf sorts openings along with their leaf hashes
+type byLeaf struct {
+	openings []GroupOpening
+	leaves   [][]byte
+}
+
+func (b byLeaf) Len() int           { return len(b.leaves) }
+func (b byLeaf) Less(i, j int) bool { return bytes.Compare(b.leaves[i], b.leaves[j]) < 0 }
+func (b byLeaf) Swap(i, j int) {
+	b.leaves[i], b.leaves[j] = b.leaves[j], b.leaves[i]
+	b.openings[i], b.openings[j] = b.openings[j], b.openings[i]
+}
+
+// Root is the base64url Merkle root the issuer signs
+func (c *GroupCommitment) Root() string {
+	return base64.RawURLEncoding.EncodeToString(c.levels[len(c.levels)-1][0])
+}
+
+// Prove makes the membership proof of group for the commitment VC credID
+func (c *GroupCommitment) Prove(credID, group string) (*GroupProof, error) {
+	index := -1
+	for i, o := range c.Openings {
+		if o.Group == group {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("group<%s> is not in the commitment of credential<%s>", group, credID)
+	}
+	proof := GroupProof{Credential: credID, Group: group, Salt: c.Openings[index].Salt}
+	for _, level := range c.levels[:len(c.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Path = append(proof.Path, MerkleStep{
+				Hash: base64.RawURLEncoding.EncodeToString(level[sibling]),
+				Left: sibling < index,
+			})
+		}
+		index /= 2
+	}
+	return &proof, nil
+}
+
+// GroupCommitmentTemplate is the template of the group commitment VC: the Organisation name and the Merkle root
+// over the groups the recipient is part of, in place of the groups themselves
+func GroupCommitmentTemplate(root string) CredentialTemplate {
+	return CredentialTemplate{
+		ID:   "http://example.edu/credentials/1872",
+		Type: []string{"VerifiableCredential", "AlumniCredential"},
+		Subject: map[string]any{
+			"alumniOf": map[string]any{ // claims are here
+				"name": []any{
+					map[string]any{"value": "Example University",
+						"lang": "en",
+					},
+				},
+			},
+			groupCommitmentClaim: map[string]any{
+				"type": GroupCommitmentType,
+				"root": root,
+			},
+		},
+	}
+}
+
+// BuildGroupCommitmentVC Makes a Verifiable Credential holding only a Merkle root over the groups the user is
+// part of. The openings go to the holder along with the VC, see Entity.AddGroupCommitment.
+func BuildGroupCommitmentVC(signer jwx.Signer, universityDID, recipientDID string, groups []string, opts ...IssueOption) (credID string, cred string, openings []GroupOpening, err error) {
+	commitment, err := NewGroupCommitment(groups)
+	if err != nil {
+		return "", "", nil, err
+	}
+	credID, cred, err = issueFromTemplate(signer, universityDID, GroupCommitmentTemplate(commitment.Root()), recipientDID, opts...)
+	if err != nil {
+		return "", "", nil, err
+	}
+	example.WriteNote(fmt.Sprintf("VC commits to %d groups with Merkle root %s", len(groups), commitment.Root()))
+	return credID, cred, commitment.Openings, nil
+}
+
+// AddGroupCommitment stores a group commitment VC in the wallet along with the openings needed to prove
+// membership of its groups
+func (e *Entity) AddGroupCommitment(credID, cred string, openings []GroupOpening) error {
+	if _, err := OpenGroupCommitment(openings); err != nil {
+		return errors.Wrapf(err, "credential<%s>", credID)
+	}
+	if err := e.AddCredential(credID, cred); err != nil {
+		return err
+	}
+	e.groupOpenings[credID] = openings
+	return e.save()
+}
+
+// RespondWithGroupProofs is RespondToPresentationRequest for group commitment VCs: the credentials are chosen
+// the same way, and for every group a membership proof from one of the chosen commitment VCs is signed into the
+// VP with them. The other groups stay hidden.
+func (e *Entity) RespondWithGroupProofs(presentationRequestJWT string, requestVerifier jwx.Verifier, groups ...string) ([]byte, error) {
+	signer, err := e.Signer()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := JWTCredentials(e.GetCredentials()...)
+	if err != nil {
+		return nil, err
+	}
+	req, err := parsePresentationRequest(presentationRequestJWT, requestVerifier)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := selectCredentials(req.definition, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	proofs := make([]GroupProof, 0, len(groups))
+	for _, group := range groups {
+		proof, err := e.proveGroup(matches, group)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, *proof)
+	}
+	example.WriteNote(fmt.Sprintf("Holder selected %d of %d credentials and proved %d groups", len(matches), len(creds), len(proofs)))
+	return buildSubmission(*signer, *req, matches, map[string]any{groupProofsClaim: proofs})
+}
+
+// proveGroup makes the membership proof of group from the first chosen commitment VC committing to it
+func (e *Entity) proveGroup(matches []descriptorMatch, group string) (*GroupProof, error) {
+	for _, m := range matches {
+		for _, id := range e.credIDs {
+			openings, ok := e.groupOpenings[id]
+			if !ok || e.creds[id] != m.cred.Token {
+				continue
+			}
+			commitment, err := OpenGroupCommitment(openings)
+			if err != nil {
+				return nil, err
+			}
+			if proof, err := commitment.Prove(id, group); err == nil {
+				return proof, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no presented group commitment VC holds group<%s>", group)
+}
+
+// provenGroups checks the group membership proofs in a verified VP against the roots of the commitment VCs
+// presented with them. The credentials are returned with the proven groups as their roles claim, so access
+// policies see them like the roles of the single VC; credentials without a proof are returned as they are.
+func provenGroups(verified *VerifiedPresentation) ([]*credential.VerifiableCredential, error) {
+	var proofs []GroupProof
+	if claim, ok := verified.Token.Get(groupProofsClaim); ok {
+		dat, err := json.Marshal(claim)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(dat, &proofs); err != nil {
+			return nil, errors.Wrap(ErrGroupProofInvalid, "malformed group proofs")
+		}
+	}
+
+	proven := make(map[string][]string)
+	for _, proof := range proofs {
+		var cred *credential.VerifiableCredential
+		for _, vc := range verified.Credentials {
+			if vc.Credential.ID == proof.Credential {
+				cred = vc.Credential
+			}
+		}
+		if cred == nil {
+			return nil, errors.Wrapf(ErrGroupProofInvalid, "credential<%s> of group<%s> is not presented", proof.Credential, proof.Group)
+		}
+		subject := cred.CredentialSubject
+		commitment, _ := subject[groupCommitmentClaim].(map[string]any)
+		if commitment["type"] != GroupCommitmentType {
+			return nil, errors.Wrapf(ErrGroupProofInvalid, "credential<%s> has no %s commitment", cred.ID, GroupCommitmentType)
+		}
+		root, _ := commitment["root"].(string)
+		if err := proof.Verify(root); err != nil {
+			return nil, err
+		}
+		proven[cred.ID] = append(proven[cred.ID], proof.Group)
+	}
+
+	creds := make([]*credential.VerifiableCredential, 0, len(verified.Credentials))
+	for _, vc := range verified.Credentials {
+		groups, ok := proven[vc.Credential.ID]
+		if !ok {
+			creds = append(creds, vc.Credential)
+			continue
+		}
+		cred := *vc.Credential
+		cred.CredentialSubject = make(map[string]any, len(vc.Credential.CredentialSubject)+1)
+		for k, v := range vc.Credential.CredentialSubject {
+			cred.CredentialSubject[k] = v
+		}
+		cred.CredentialSubject["roles"] = roleClaims(groups)
+		creds = append(creds, &cred)
+	}
+	return creds, nil
+}
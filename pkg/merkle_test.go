@@ -0,0 +1,161 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+func TestGroupCommitment(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		t.Run(fmt.Sprintf("%d groups", n), func(t *testing.T) {
+			var groups []string
+			for i := 0; i < n; i++ {
+				groups = append(groups, fmt.Sprintf("G%d", i))
+			}
+			commitment, err := NewGroupCommitment(groups)
+			if err != nil {
+				t.Fatalf("making commitment: %v", err)
+			}
+			reopened, err := OpenGroupCommitment(commitment.Openings)
+			if err != nil {
+				t.Fatalf("opening commitment: %v", err)
+			}
+			if reopened.Root() != commitment.Root() {
+				t.Fatalf("expected the openings to give root<%s>, got<%s>", commitment.Root(), reopened.Root())
+			}
+			for _, group := range groups {
+				proof, err := reopened.Prove("cred-1", group)
+				if err != nil {
+					t.Fatalf("proving group<%s>: %v", group, err)
+				}
+				if err = proof.Verify(commitment.Root()); err != nil {
+					t.Fatalf("verifying proof of group<%s>: %v", group, err)
+				}
+			}
+			if _, err = commitment.Prove("cred-1", "missing"); err == nil {
+				t.Fatal("expected a group outside the commitment not to be proven")
+			}
+		})
+	}
+
+	if _, err := NewGroupCommitment([]string{"G1", "G1"}); err == nil {
+		t.Fatal("expected a group committed to twice to be rejected")
+	}
+}
+
+func TestGroupProofTampered(t *testing.T) {
+	commitment, err := NewGroupCommitment([]string{"G1", "G2", "G3", "G4", "G5"})
+	if err != nil {
+		t.Fatalf("making commitment: %v", err)
+	}
+	other, err := NewGroupCommitment([]string{"G1", "G2", "G3", "G4", "G5"})
+	if err != nil {
+		t.Fatalf("making commitment: %v", err)
+	}
+	otherProof, err := other.Prove("cred-1", "G3")
+	if err != nil {
+		t.Fatalf("proving group: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(p *GroupProof)
+	}{
+		{name: "other group", tamper: func(p *GroupProof) { p.Group = "G6" }},
+		{name: "other salt", tamper: func(p *GroupProof) { p.Salt = otherProof.Salt }},
+		{name: "other sibling", tamper: func(p *GroupProof) { p.Path[0].Hash = otherProof.Path[0].Hash }},
+		{name: "sibling on the other side", tamper: func(p *GroupProof) { p.Path[0].Left = !p.Path[0].Left }},
+		{name: "step dropped", tamper: func(p *GroupProof) { p.Path = p.Path[1:] }},
+		{name: "step added", tamper: func(p *GroupProof) { p.Path = append(p.Path, otherProof.Path[0]) }},
+		{name: "sibling not a hash", tamper: func(p *GroupProof) { p.Path[0].Hash = base64.RawURLEncoding.EncodeToString([]byte("short")) }},
+		{name: "proof of another commitment", tamper: func(p *GroupProof) { *p = *otherProof }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := commitment.Prove("cred-1", "G3")
+			if err != nil {
+				t.Fatalf("proving group: %v", err)
+			}
+			tt.tamper(proof)
+			if err = proof.Verify(commitment.Root()); !errors.Is(err, ErrGroupProofInvalid) {
+				t.Fatalf("expected %v, got %v", ErrGroupProofInvalid, err)
+			}
+		})
+	}
+}
+
+func TestProvenGroups(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	commitment, err := NewGroupCommitment([]string{"G1", TeachingAssistantRole, "G3"})
+	if err != nil {
+		t.Fatalf("making commitment: %v", err)
+	}
+	committed, err := NewIssuer(*university).Issue(GroupCommitmentTemplate(commitment.Root()), student.ID)
+	if err != nil {
+		t.Fatalf("issuing commitment VC: %v", err)
+	}
+	single, err := NewIssuer(*university).Issue(SingleVCTemplate([]string{"G1"}), student.ID)
+	if err != nil {
+		t.Fatalf("issuing credential: %v", err)
+	}
+	single.Credential.ID = "single"
+	proof, err := commitment.Prove(committed.ID, TeachingAssistantRole)
+	if err != nil {
+		t.Fatalf("proving group: %v", err)
+	}
+	unpresented := *proof
+	unpresented.Credential = "missing"
+	uncommitted := *proof
+	uncommitted.Credential = single.Credential.ID
+
+	tests := []struct {
+		name    string
+		proofs  []GroupProof
+		wantErr error
+	}{
+		{name: "proven group", proofs: []GroupProof{*proof}},
+		{name: "no proofs"},
+		{name: "credential not presented", proofs: []GroupProof{unpresented}, wantErr: ErrGroupProofInvalid},
+		{name: "credential without a commitment", proofs: []GroupProof{uncommitted}, wantErr: ErrGroupProofInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.New()
+			if tt.proofs != nil {
+				if err := token.Set(groupProofsClaim, tt.proofs); err != nil {
+					t.Fatalf("setting group proofs: %v", err)
+				}
+			}
+			verified := VerifiedPresentation{
+				Holder: student.ID,
+				Token:  token,
+				Credentials: []VerifiedCredential{
+					{JWT: committed.JWT, Credential: committed.Credential},
+					{JWT: single.JWT, Credential: single.Credential},
+				},
+			}
+			creds, err := provenGroups(&verified)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checking group proofs: %v", err)
+			}
+			roles, hasRoles := creds[0].CredentialSubject["roles"]
+			if hasRoles != (len(tt.proofs) > 0) {
+				t.Fatalf("expected roles only for proven groups, got %v", roles)
+			}
+			if _, ok := committed.Credential.CredentialSubject["roles"]; ok {
+				t.Fatal("expected the presented credential to be left as it is")
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/goccy/go-json"
+	"github.com/oliveagle/jsonpath"
+	"gopkg.in/yaml.v3"
+)
+
+// Predicate operators a ClaimPredicate can use
+const (
+	OpExists    = "exists"
+	OpEquals    = "equals"
+	OpNotEquals = "notEquals"
+	OpIn        = "in"
+	OpContains  = "contains"
+	OpMatches   = "matches"
+	OpGTE       = "gte"
+	OpLTE       = "lte"
+)
+
+// AccessPolicy describes what a verifier requires before granting access. Every requirement must be met by
+// one of the presented credentials; credentials can be presented in any order and in any number.
+type AccessPolicy struct {
+	Name         string                  `json:"name,omitempty" yaml:"name,omitempty"`
+	Requirements []CredentialRequirement `json:"requirements" yaml:"requirements"`
+}
+
+// CredentialRequirement is what a single presented credential has to satisfy. Empty fields are not checked.
+type CredentialRequirement struct {
+	// ID names the requirement in decisions; defaults to requirement-<n>
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Types the credential must all have, e.g. AlumniMemberCredential
+	Types []string `json:"types,omitempty" yaml:"types,omitempty"`
+	// Issuers is the list of DIDs the credential may be issued by
+	Issuers []string `json:"issuers,omitempty" yaml:"issuers,omitempty"`
+	// Roles the credential must hold at least one of, wherever its roles claim is in the subject
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// Claims are predicates over the credential JSON which must all hold
+	Claims []ClaimPredicate `json:"claims,omitempty" yaml:"claims,omitempty"`
+}
+
+// ClaimPredicate tests the value at a JSONPath of the credential, e.g. $.credentialSubject.alumniOf.name[*].value.
+// When a wildcard path selects several values the predicate holds if any of them satisfies it.
+type ClaimPredicate struct {
+	Path  string `json:"path" yaml:"path"`
+	Op    string `json:"op" yaml:"op"`
+	Value any    `json:"value,omitempty" yaml:"value,omitempty"`
+	// Values is the set used by the in operator
+	Values []any `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// IsValid checks the policy can be evaluated
+func (p *AccessPolicy) IsValid() error {
+	if len(p.Requirements) == 0 {
+		return fmt.Errorf("access policy<%s> must have at least one requirement", p.Name)
+	}
+	for _, req := range p.requirements() {
+		for _, pred := range req.Claims {
+			if err := pred.isValid(); err != nil {
+				return fmt.Errorf("requirement<%s>: %w", req.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// requirements returns a copy of the policy's requirements with the unnamed ones named requirement-<n>. The
+// policy itself is left as it is, so it can be evaluated concurrently.
+func (p AccessPolicy) requirements() []CredentialRequirement {
+	reqs := make([]CredentialRequirement, len(p.Requirements))
+	copy(reqs, p.Requirements)
+	for i := range reqs {
+		if reqs[i].ID == "" {
+			reqs[i].ID = fmt.Sprintf("requirement-%d", i)
+		}
+	}
+	return reqs
+}
+
+func (c ClaimPredicate) isValid() error {
+	if !strings.HasPrefix(c.Path, "$") {
+		return fmt.Errorf("claim path<%s> must be a JSONPath starting with $", c.Path)
+	}
+	switch c.Op {
+	case OpExists, OpEquals, OpNotEquals, OpContains:
+	case OpIn:
+		if len(c.Values) == 0 {
+			return fmt.Errorf("claim<%s>: operator %s needs values", c.Path, c.Op)
+		}
+	case OpMatches:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return fmt.Errorf("claim<%s>: operator %s needs a string pattern", c.Path, c.Op)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("claim<%s>: %w", c.Path, err)
+		}
+	case OpGTE, OpLTE:
+		if _, ok := toFloat(c.Value); !ok {
+			return fmt.Errorf("claim<%s>: operator %s needs a number", c.Path, c.Op)
+		}
+	default:
+		return fmt.Errorf("claim<%s>: unknown operator<%s>", c.Path, c.Op)
+	}
+	return nil
+}
+
+// LoadAccessPolicy reads an access policy from a .json, .yaml or .yml file
+func LoadAccessPolicy(path string) (*AccessPolicy, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p AccessPolicy
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(dat, &p)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(dat, &p)
+	default:
+		return nil, fmt.Errorf("unsupported policy file<%s>; expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy<%s>: %w", path, err)
+	}
+	if err = p.IsValid(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// TeachingAssistantPolicy is the employer's policy in the demo: a credential from the university holding the
+// Teaching Assistant role. It holds for the single VC of case 1 and for the membership VC of case 2.
+func TeachingAssistantPolicy(universityDID string) AccessPolicy {
+	return AccessPolicy{
+		Name: "teaching-assistant",
+		Requirements: []CredentialRequirement{
+			{
+				ID:      "ta-role",
+				Issuers: []string{universityDID},
+				Roles:   []string{TeachingAssistantRole},
+			},
+		},
+	}
+}
+
+// Evaluate checks the policy against verified credentials. Each requirement is met by the first credential
+// satisfying it; the same credential may meet several requirements. A requirement no credential meets is
+// reported with the reason of every credential that missed it.
+func (p AccessPolicy) Evaluate(creds []*credential.VerifiableCredential) AccessDecision {
+	decision := AccessDecision{Allowed: true, MatchedCredentials: make(map[string]string)}
+	if err := p.IsValid(); err != nil {
+		decision.deny(DenialReason{Code: ReasonInvalidPolicy, Message: err.Error()})
+		return decision
+	}
+	for _, req := range p.requirements() {
+		var misses []DenialReason
+		for _, cred := range creds {
+			claims, miss := req.check(cred)
+			if miss == nil {
+				decision.MatchedCredentials[req.ID] = cred.ID
+				decision.MatchedClaims = append(decision.MatchedClaims, claims...)
+				break
+			}
+			misses = append(misses, *miss)
+		}
+		if _, ok := decision.MatchedCredentials[req.ID]; ok {
+			continue
+		}
+		if len(creds) == 0 {
+			misses = append(misses, DenialReason{Code: ReasonNoCredentials, Requirement: req.ID, Message: "no credentials presented"})
+		}
+		for _, miss := range misses {
+			decision.deny(miss)
+		}
+	}
+	return decision
+}
+
+// check returns the claims cred satisfies the requirement with, or why it does not
+func (req CredentialRequirement) check(cred *credential.VerifiableCredential) ([]MatchedClaim, *DenialReason) {
+	miss := func(code ReasonCode, format string, args ...any) *DenialReason {
+		return &DenialReason{Code: code, Requirement: req.ID, CredentialID: cred.ID, Message: fmt.Sprintf(format, args...)}
+	}
+	matched := func(path string, value any) MatchedClaim {
+		return MatchedClaim{Requirement: req.ID, CredentialID: cred.ID, Path: path, Value: value}
+	}
+
+	var claims []MatchedClaim
+	if len(req.Issuers) > 0 {
+		issuer, _ := cred.Issuer.(string)
+		if !util.Contains(issuer, req.Issuers) {
+			return nil, miss(ReasonIssuerUntrusted, "issuer<%s> is not one of %v", issuer, req.Issuers)
+		}
+		claims = append(claims, matched("$.issuer", issuer))
+	}
+	if len(req.Types) > 0 {
+		types, _ := util.InterfaceToStrings(cred.Type)
+		for _, t := range req.Types {
+			if !util.Contains(t, types) {
+				return nil, miss(ReasonTypeMissing, "is not of type<%s>", t)
+			}
+		}
+		claims = append(claims, matched("$.type", req.Types))
+	}
+	if len(req.Roles) > 0 {
+		found := ""
+		for _, role := range credentialRoles(cred.CredentialSubject) {
+			if util.Contains(role, req.Roles) {
+				found = role
+				break
+			}
+		}
+		if found == "" {
+			return nil, miss(ReasonRoleMissing, "holds none of the roles %v", req.Roles)
+		}
+		claims = append(claims, matched("$.credentialSubject..roles[*].value", found))
+	}
+	if len(req.Claims) > 0 {
+		credJSON, err := util.ToJSONMap(cred)
+		if err != nil {
+			return nil, miss(ReasonClaimMismatch, "%s", err)
+		}
+		for _, pred := range req.Claims {
+			value, ok := pred.holds(credJSON)
+			if !ok {
+				return nil, miss(ReasonClaimMismatch, "fails %s %s %v", pred.Path, pred.Op, pred.expected())
+			}
+			claims = append(claims, matched(pred.Path, value))
+		}
+	}
+	return claims, nil
+}
+
+// credentialRoles collects the values of every roles claim in a credential subject
+func credentialRoles(subject map[string]any) []string {
+	var roles []string
+	for k, v := range subject {
+		switch val := v.(type) {
+		case map[string]any:
+			roles = append(roles, credentialRoles(val)...)
+		case []any:
+			if k != "roles" {
+				continue
+			}
+			for _, r := range val {
+				if role, ok := r.(map[string]any); ok {
+					if value, ok := role["value"].(string); ok {
+						roles = append(roles, value)
+					}
+				}
+			}
+		}
+	}
+	return roles
+}
+
+func (c ClaimPredicate) expected() any {
+	if c.Op == OpIn {
+		return c.Values
+	}
+	return c.Value
+}
+
+// holds evaluates the predicate against a credential as JSON and returns the value that satisfied it
+func (c ClaimPredicate) holds(doc map[string]any) (any, bool) {
+	values, found := lookupPath(doc, c.Path)
+	if !found {
+		return nil, false
+	}
+	for _, v := range values {
+		if c.holdsFor(v) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (c ClaimPredicate) holdsFor(v any) bool {
+	switch c.Op {
+	case OpExists:
+		return true
+	case OpEquals:
+		return jsonEqual(v, c.Value)
+	case OpNotEquals:
+		return !jsonEqual(v, c.Value)
+	case OpIn:
+		for _, candidate := range c.Values {
+			if jsonEqual(v, candidate) {
+				return true
+			}
+		}
+		return false
+	case OpContains:
+		if list, ok := v.([]any); ok {
+			for _, item := range list {
+				if jsonEqual(item, c.Value) {
+					return true
+				}
+			}
+			return false
+		}
+		s, ok := v.(string)
+		sub, subOK := c.Value.(string)
+		return ok && subOK && strings.Contains(s, sub)
+	case OpMatches:
+		s, ok := v.(string)
+		return ok && regexp.MustCompile(c.Value.(string)).MatchString(s)
+	case OpGTE, OpLTE:
+		have, ok := toFloat(v)
+		want, _ := toFloat(c.Value)
+		if !ok {
+			return false
+		}
+		if c.Op == OpGTE {
+			return have >= want
+		}
+		return have <= want
+	}
+	return false
+}
+
+// lookupPath resolves a JSONPath in doc. A wildcard path yields all the selected values, any other path
+// yields the single value it points at.
+func lookupPath(doc any, path string) ([]any, bool) {
+	value, err := jsonpath.JsonPathLookup(doc, path)
+	if err != nil {
+		return nil, false
+	}
+	if multi, ok := value.([]any); ok && (strings.Contains(path, "[*]") || strings.Contains(path, "..")) {
+		return multi, len(multi) > 0
+	}
+	return []any{value}, true
+}
+
+// jsonEqual compares values the way they would compare as JSON, so 1 from a YAML policy equals 1.0 from a credential
+func jsonEqual(a, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	aj, err1 := json.Marshal(a)
+	bj, err2 := json.Marshal(b)
+	if err1 != nil || err2 != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	var an, bn any
+	_ = json.Unmarshal(aj, &an)
+	_ = json.Unmarshal(bj, &bn)
+	return reflect.DeepEqual(an, bn)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+)
+
+func TestEvaluateUnnamedRequirements(t *testing.T) {
+	policy := AccessPolicy{
+		Name: "unnamed",
+		Requirements: []CredentialRequirement{
+			{Issuers: []string{"did:example:university"}},
+			{ID: "ta-role", Roles: []string{TeachingAssistantRole}},
+		},
+	}
+	cred := &credential.VerifiableCredential{ID: "cred-1", Issuer: "did:example:other"}
+
+	// run under -race, concurrent evaluations of one policy must not write to it
+	var wg sync.WaitGroup
+	decisions := make([]AccessDecision, 4)
+	for i := range decisions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			decisions[i] = policy.Evaluate([]*credential.VerifiableCredential{cred})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, decision := range decisions {
+		if decision.Allowed {
+			t.Fatal("expected no access")
+		}
+		var requirements []string
+		for _, r := range decision.Reasons {
+			requirements = append(requirements, r.Requirement)
+		}
+		if len(requirements) != 2 || requirements[0] != "requirement-0" || requirements[1] != "ta-role" {
+			t.Fatalf("expected the misses of requirement-0 and ta-role, got %v", requirements)
+		}
+	}
+	if policy.Requirements[0].ID != "" {
+		t.Fatalf("expected the policy to be left as it is, got requirement<%s>", policy.Requirements[0].ID)
+	}
+}
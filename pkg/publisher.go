@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Publisher is a small local HTTP server for documents other parties need to fetch, such as status list
+// credentials. In the demo every entity runs in one process, so it stands in for the issuer's web server.
+type Publisher struct {
+	// URL is the base URL the publisher is reachable at, e.g. http://127.0.0.1:41234
+	URL    string
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// NewPublisher starts serving on addr. Use "127.0.0.1:0" to pick a free port.
+func NewPublisher(addr string) (*Publisher, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	p := Publisher{
+		URL:    "http://" + listener.Addr().String(),
+		mux:    mux,
+		server: &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+	}
+	go func() {
+		_ = p.server.Serve(listener)
+	}()
+	return &p, nil
+}
+
+// Handle registers a handler for the given pattern, as http.ServeMux does
+func (p *Publisher) Handle(pattern string, handler http.Handler) {
+	p.mux.Handle(pattern, handler)
+}
+
+// Close stops the server
+func (p *Publisher) Close() error {
+	return p.server.Close()
+}
@@ -0,0 +1,361 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/pkg/errors"
+)
+
+const (
+	// IdentityGroup is the input descriptor group of the identity VC in MakeMembershipPresentationData
+	IdentityGroup = "identity"
+	// MembershipGroup is the input descriptor group of the membership VCs in MakeMembershipPresentationData
+	MembershipGroup = "membership"
+)
+
+// AllFrom requires every input descriptor of a group to be answered
+func AllFrom(group string) exchange.SubmissionRequirement {
+	return exchange.SubmissionRequirement{Rule: exchange.All, FromOption: exchange.FromOption{From: group}}
+}
+
+// PickFrom requires exactly count input descriptors of a group to be answered or, with count 0, at least min
+// and at most max of them (0 leaves a bound open)
+func PickFrom(group string, count, min, max int) exchange.SubmissionRequirement {
+	return exchange.SubmissionRequirement{
+		Rule:       exchange.Pick,
+		FromOption: exchange.FromOption{From: group},
+		Count:      count,
+		Minimum:    min,
+		Maximum:    max,
+	}
+}
+
+// AllOf requires every nested requirement to be met
+func AllOf(nested ...exchange.SubmissionRequirement) exchange.SubmissionRequirement {
+	return exchange.SubmissionRequirement{Rule: exchange.All, FromOption: exchange.FromOption{FromNested: nested}}
+}
+
+// PickOf requires exactly count nested requirements to be met or, with count 0, at least min and at most max
+func PickOf(count, min, max int, nested ...exchange.SubmissionRequirement) exchange.SubmissionRequirement {
+	return exchange.SubmissionRequirement{
+		Rule:       exchange.Pick,
+		FromOption: exchange.FromOption{FromNested: nested},
+		Count:      count,
+		Minimum:    min,
+		Maximum:    max,
+	}
+}
+
+// MakeMembershipPresentationData asks for the identity VC plus at least min and at most max (0 for no bound)
+// membership VCs from the trusted issuer, each holding one of roles. One input descriptor is made per role, so
+// "any one of these groups" is min 1, max 1 and "at least 2 of 5 groups" is min 2, max 0.
+func MakeMembershipPresentationData(id, trustedIssuer string, roles []string, min, max int) (exchange.PresentationDefinition, error) {
+	if len(roles) == 0 {
+		return exchange.PresentationDefinition{}, errors.New("at least one role is needed")
+	}
+	if min > len(roles) || (max > 0 && min > max) {
+		return exchange.PresentationDefinition{}, fmt.Errorf("cannot pick between %d and %d of %d roles", min, max, len(roles))
+	}
+	b := NewPresentationDefinition(id).
+		Require(AllFrom(IdentityGroup), PickFrom(MembershipGroup, 0, min, max)).
+		Descriptor(NewInputDescriptor("identity").
+			Group(IdentityGroup).
+			Field(issuerField("issuer", "need to check the issuer", trustedIssuer)).
+			Field(NewField(alumniOfPath).ID("identity").Purpose("need the identity VC the memberships are linked to")))
+	for i, role := range roles {
+		b.Descriptor(NewInputDescriptor(fmt.Sprintf("membership-%d", i)).
+			Name(role).
+			Group(MembershipGroup).
+			Field(issuerField("issuer", "need to check the issuer", trustedIssuer)).
+			Field(roleField("role", role)))
+	}
+	return b.Build()
+}
+
+// requirementBounds returns how many of n items a requirement needs: at least low and at most high
+func requirementBounds(req exchange.SubmissionRequirement, n int) (low, high int) {
+	switch {
+	case req.Rule == exchange.All:
+		return n, n
+	case req.Count > 0:
+		return req.Count, req.Count
+	default:
+		high = n
+		if req.Maximum > 0 && req.Maximum < high {
+			high = req.Maximum
+		}
+		return req.Minimum, high
+	}
+}
+
+// describeRequirement names a requirement in errors, e.g. pick 2 from group<membership>
+func describeRequirement(req exchange.SubmissionRequirement) string {
+	var rule string
+	switch {
+	case req.Rule == exchange.All:
+		rule = "all"
+	case req.Count > 0:
+		rule = fmt.Sprintf("pick %d", req.Count)
+	case req.Maximum > 0 && req.Minimum == req.Maximum:
+		rule = fmt.Sprintf("pick %d", req.Minimum)
+	case req.Maximum > 0:
+		rule = fmt.Sprintf("pick %d to %d", req.Minimum, req.Maximum)
+	default:
+		rule = fmt.Sprintf("pick at least %d", req.Minimum)
+	}
+	if req.Name != "" {
+		rule = fmt.Sprintf("%s<%s>", rule, req.Name)
+	}
+	if req.From != "" {
+		return fmt.Sprintf("%s from group<%s>", rule, req.From)
+	}
+	return fmt.Sprintf("%s of %d nested requirements", rule, len(req.FromNested))
+}
+
+// groupDescriptors maps each group to the indices of its input descriptors, in definition order
+func groupDescriptors(def exchange.PresentationDefinition) map[string][]int {
+	groups := make(map[string][]int)
+	for i, desc := range def.InputDescriptors {
+		for _, g := range desc.Group {
+			groups[g] = append(groups[g], i)
+		}
+	}
+	return groups
+}
+
+// requirementMet checks a requirement against the input descriptors that were answered
+func requirementMet(req exchange.SubmissionRequirement, groups map[string][]int, answered map[int]bool) error {
+	var met int
+	var total int
+	var misses []string
+	if req.From != "" {
+		descriptors, ok := groups[req.From]
+		if !ok {
+			return fmt.Errorf("%s: no input descriptor is in the group", describeRequirement(req))
+		}
+		total = len(descriptors)
+		for _, d := range descriptors {
+			if answered[d] {
+				met++
+			}
+		}
+	} else {
+		total = len(req.FromNested)
+		for _, nested := range req.FromNested {
+			if err := requirementMet(nested, groups, answered); err != nil {
+				misses = append(misses, err.Error())
+				continue
+			}
+			met++
+		}
+	}
+	low, high := requirementBounds(req, total)
+	if met < low || met > high {
+		msg := fmt.Sprintf("%s: %d of %d met", describeRequirement(req), met, total)
+		if len(misses) > 0 {
+			msg += " (" + strings.Join(misses, "; ") + ")"
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// checkSubmissionRequirements checks that the answered input descriptors meet every submission requirement of
+// the definition. Without submission requirements every input descriptor has to be answered.
+func checkSubmissionRequirements(def exchange.PresentationDefinition, answered map[int]bool) error {
+	if len(def.SubmissionRequirements) == 0 {
+		for i, desc := range def.InputDescriptors {
+			if !answered[i] {
+				return fmt.Errorf("input descriptor<%s> was not answered", desc.ID)
+			}
+		}
+		return nil
+	}
+	groups := groupDescriptors(def)
+	for _, req := range def.SubmissionRequirements {
+		if err := requirementMet(req, groups, answered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planRequirement chooses the fewest input descriptors meeting a requirement among the ones the holder can
+// answer, or says why it cannot be met
+func planRequirement(req exchange.SubmissionRequirement, groups map[string][]int, available map[int]bool, unmet map[int]string) ([]int, error) {
+	if req.From != "" {
+		descriptors, ok := groups[req.From]
+		if !ok {
+			return nil, fmt.Errorf("%s: no input descriptor is in the group", describeRequirement(req))
+		}
+		low, _ := requirementBounds(req, len(descriptors))
+		var chosen []int
+		var misses []string
+		for _, d := range descriptors {
+			if available[d] {
+				if len(chosen) < low {
+					chosen = append(chosen, d)
+				}
+				continue
+			}
+			misses = append(misses, unmet[d])
+		}
+		if len(chosen) < low {
+			return nil, fmt.Errorf("%s: only %d of the %d needed can be answered (%s)",
+				describeRequirement(req), len(chosen), low, strings.Join(misses, "; "))
+		}
+		return chosen, nil
+	}
+
+	low, _ := requirementBounds(req, len(req.FromNested))
+	var chosen []int
+	var met int
+	var misses []string
+	for _, nested := range req.FromNested {
+		if met == low {
+			break
+		}
+		descriptors, err := planRequirement(nested, groups, available, unmet)
+		if err != nil {
+			misses = append(misses, err.Error())
+			continue
+		}
+		chosen = append(chosen, descriptors...)
+		met++
+	}
+	if met < low {
+		return nil, fmt.Errorf("%s: only %d of the %d needed can be met (%s)",
+			describeRequirement(req), met, low, strings.Join(misses, "; "))
+	}
+	return chosen, nil
+}
+
+// leastDescriptors is a lower bound on the number of input descriptors answering a requirement
+func leastDescriptors(req exchange.SubmissionRequirement, groups map[string][]int) int {
+	if req.From != "" {
+		low, _ := requirementBounds(req, len(groups[req.From]))
+		return low
+	}
+	least := make([]int, 0, len(req.FromNested))
+	for _, nested := range req.FromNested {
+		least = append(least, leastDescriptors(nested, groups))
+	}
+	sort.Ints(least)
+	low, _ := requirementBounds(req, len(req.FromNested))
+	total := 0
+	for i := 0; i < low && i < len(least); i++ {
+		total += least[i]
+	}
+	return total
+}
+
+// smallestSubmission searches the sets of from to below candidates, smallest first, for one meeting every
+// submission requirement. Like minimalCover the search gives up after maxSelectionSteps sets.
+func smallestSubmission(def exchange.PresentationDefinition, candidates []int, from, below int) []int {
+	steps := 0
+	for size := from; size < below && size <= len(candidates); size++ {
+		// the indices into candidates of the current set, advanced in lexicographic order
+		set := make([]int, size)
+		for i := range set {
+			set[i] = i
+		}
+		for {
+			steps++
+			if steps > maxSelectionSteps {
+				return nil
+			}
+			answered := make(map[int]bool, size)
+			for _, c := range set {
+				answered[candidates[c]] = true
+			}
+			if checkSubmissionRequirements(def, answered) == nil {
+				chosen := make([]int, 0, size)
+				for _, c := range set {
+					chosen = append(chosen, candidates[c])
+				}
+				return chosen
+			}
+			i := size - 1
+			for i >= 0 && set[i] == len(candidates)-size+i {
+				i--
+			}
+			if i < 0 {
+				break
+			}
+			set[i]++
+			for j := i + 1; j < size; j++ {
+				set[j] = set[j-1] + 1
+			}
+		}
+	}
+	return nil
+}
+
+// planSubmission chooses which input descriptors the holder answers: all of them without submission
+// requirements, otherwise the fewest meeting every requirement. The result is sorted in definition order.
+// Requirements are first planned one at a time; as the descriptors chosen for one can break the max or count of
+// another over the same group, or answer it with fewer descriptors, the sets of answerable descriptors are then
+// searched for the smallest meeting them all, falling back to the first plan if the search gives up.
+func planSubmission(def exchange.PresentationDefinition, available map[int]bool, unmet map[int]string) ([]int, error) {
+	if len(def.SubmissionRequirements) == 0 {
+		var missing []string
+		for i := range def.InputDescriptors {
+			if !available[i] {
+				missing = append(missing, unmet[i])
+			}
+		}
+		if len(missing) > 0 {
+			return nil, errors.Wrap(ErrUnmetInputDescriptor, strings.Join(missing, "; "))
+		}
+		chosen := make([]int, len(def.InputDescriptors))
+		for i := range chosen {
+			chosen[i] = i
+		}
+		return chosen, nil
+	}
+
+	groups := groupDescriptors(def)
+	picked := make(map[int]bool)
+	least := 0
+	for _, req := range def.SubmissionRequirements {
+		descriptors, err := planRequirement(req, groups, available, unmet)
+		if err != nil {
+			return nil, errors.Wrap(ErrUnmetInputDescriptor, err.Error())
+		}
+		for _, d := range descriptors {
+			picked[d] = true
+		}
+		if n := leastDescriptors(req, groups); n > least {
+			least = n
+		}
+	}
+	var planned []int
+	for i := range def.InputDescriptors {
+		if picked[i] {
+			planned = append(planned, i)
+		}
+	}
+	conflict := checkSubmissionRequirements(def, picked)
+
+	// descriptors in no group are never asked for by a requirement
+	var candidates []int
+	for i, desc := range def.InputDescriptors {
+		if available[i] && len(desc.Group) > 0 {
+			candidates = append(candidates, i)
+		}
+	}
+	below := len(candidates) + 1
+	if conflict == nil {
+		below = len(planned)
+	}
+	if chosen := smallestSubmission(def, candidates, least, below); chosen != nil {
+		return chosen, nil
+	}
+	if conflict != nil {
+		return nil, errors.Wrap(ErrUnmetInputDescriptor, "requirements conflict: "+conflict.Error())
+	}
+	return planned, nil
+}
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+)
+
+func TestPlanSubmission(t *testing.T) {
+	descriptors := []exchange.InputDescriptor{
+		{ID: "identity", Group: []string{IdentityGroup}},
+		{ID: "membership-0", Group: []string{MembershipGroup, "A"}},
+		{ID: "membership-1", Group: []string{MembershipGroup, "A", "B"}},
+		{ID: "membership-2", Group: []string{MembershipGroup}},
+	}
+	all := map[int]bool{0: true, 1: true, 2: true, 3: true}
+	unmet := map[int]string{0: "no identity", 1: "no membership-0", 2: "no membership-1", 3: "no membership-2"}
+
+	tests := []struct {
+		name         string
+		requirements []exchange.SubmissionRequirement
+		available    map[int]bool
+		want         []int
+		wantErr      error
+	}{
+		{
+			name:      "no requirements answers every descriptor",
+			available: all,
+			want:      []int{0, 1, 2, 3},
+		},
+		{
+			name:      "no requirements with a descriptor missing",
+			available: map[int]bool{0: true, 1: true, 2: true},
+			wantErr:   ErrUnmetInputDescriptor,
+		},
+		{
+			name:         "fewest descriptors meeting the requirements",
+			requirements: []exchange.SubmissionRequirement{AllFrom(IdentityGroup), PickFrom(MembershipGroup, 0, 1, 1)},
+			available:    all,
+			want:         []int{0, 1},
+		},
+		{
+			name:         "pick skips descriptors that cannot be answered",
+			requirements: []exchange.SubmissionRequirement{AllFrom(IdentityGroup), PickFrom(MembershipGroup, 2, 0, 0)},
+			available:    map[int]bool{0: true, 2: true, 3: true},
+			want:         []int{0, 2, 3},
+		},
+		{
+			name:         "too few answerable descriptors",
+			requirements: []exchange.SubmissionRequirement{PickFrom(MembershipGroup, 0, 2, 0)},
+			available:    map[int]bool{0: true, 1: true},
+			wantErr:      ErrUnmetInputDescriptor,
+		},
+		{
+			name:         "nested pick of one",
+			requirements: []exchange.SubmissionRequirement{PickOf(1, 0, 0, AllFrom(IdentityGroup), AllFrom(MembershipGroup))},
+			available:    map[int]bool{1: true, 2: true, 3: true},
+			want:         []int{1, 2, 3},
+		},
+		{
+			name:         "requirements over overlapping groups",
+			requirements: []exchange.SubmissionRequirement{PickFrom("A", 1, 0, 0), AllFrom("B")},
+			available:    all,
+			want:         []int{2},
+		},
+		{
+			name:         "requirements answered together with fewer descriptors",
+			requirements: []exchange.SubmissionRequirement{PickFrom("A", 0, 1, 0), PickFrom("B", 1, 0, 0)},
+			available:    all,
+			want:         []int{2},
+		},
+		{
+			name:         "requirements over the same group conflict",
+			requirements: []exchange.SubmissionRequirement{PickFrom(MembershipGroup, 0, 0, 1), AllFrom(MembershipGroup)},
+			available:    all,
+			wantErr:      ErrUnmetInputDescriptor,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := exchange.PresentationDefinition{ID: "test", InputDescriptors: descriptors, SubmissionRequirements: tt.requirements}
+			got, err := planSubmission(def, tt.available, unmet)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planning submission: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected descriptors %v, got %v", tt.want, got)
+			}
+			answered := make(map[int]bool)
+			for _, d := range got {
+				answered[d] = true
+			}
+			if err = checkSubmissionRequirements(def, answered); err != nil {
+				t.Fatalf("planned submission does not meet the requirements: %v", err)
+			}
+		})
+	}
+}
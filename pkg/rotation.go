@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/cryptosuite"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/pkg/errors"
+)
+
+// DefaultKeyGracePeriod is how long a key replaced by RotateKey stays in the DID document
+const DefaultKeyGracePeriod = 30 * 24 * time.Hour
+
+// PublishedDocument is a DID document as its controller publishes it. The keys in Retired were replaced and are
+// only resolved until the time given for them, so what they signed can still be verified for a while.
+type PublishedDocument struct {
+	Document did.Document
+	// Retired holds when each retired key stops being resolved, by verification method id
+	Retired map[string]time.Time
+}
+
+// current returns the document without the retired keys whose grace period is over
+func (p PublishedDocument) current(now time.Time) did.Document {
+	doc := p.Document
+	doc.VerificationMethod = nil
+	kept := make(map[string]bool)
+	for _, vm := range p.Document.VerificationMethod {
+		if until, retired := p.Retired[vm.ID]; retired && !now.Before(until) {
+			continue
+		}
+		doc.VerificationMethod = append(doc.VerificationMethod, vm)
+		kept[vm.ID] = true
+	}
+	doc.Authentication = referencedMethods(p.Document.Authentication, kept)
+	doc.AssertionMethod = referencedMethods(p.Document.AssertionMethod, kept)
+	return doc
+}
+
+// referencedMethods drops the references to verification methods that are not kept
+func referencedMethods(set []did.VerificationMethodSet, kept map[string]bool) []did.VerificationMethodSet {
+	var methods []did.VerificationMethodSet
+	for _, m := range set {
+		if ref, ok := m.(string); ok && !kept[ref] {
+			continue
+		}
+		methods = append(methods, m)
+	}
+	return methods
+}
+
+// DIDPublisher is where an entity publishes its DID document: a DIDRegistry, or the DIDWebHost serving its
+// did:web DID
+type DIDPublisher interface {
+	Publish(doc PublishedDocument) error
+}
+
+// DIDRegistry holds the DID documents entities publish as they rotate their keys. It resolves a DID to its
+// published document and any other DID with the fallback resolver, so verifiers use it as their resolver.
+type DIDRegistry struct {
+	fallback resolution.Resolver
+
+	mux  sync.RWMutex
+	docs map[string]PublishedDocument
+}
+
+// NewDIDRegistry makes an empty registry resolving unpublished DIDs with fallback
+func NewDIDRegistry(fallback resolution.Resolver) *DIDRegistry {
+	return &DIDRegistry{fallback: fallback, docs: make(map[string]PublishedDocument)}
+}
+
+// Publish replaces the published document of its DID
+func (r *DIDRegistry) Publish(doc PublishedDocument) error {
+	if doc.Document.ID == "" {
+		return errors.New("published DID document has no id")
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.docs[doc.Document.ID] = doc
+	return nil
+}
+
+// Resolve returns the published document of id, without the keys whose grace period is over, or resolves it with
+// the fallback resolver if it was not published
+func (r *DIDRegistry) Resolve(ctx context.Context, id string, opts ...resolution.ResolutionOption) (*resolution.ResolutionResult, error) {
+	r.mux.RLock()
+	published, ok := r.docs[id]
+	r.mux.RUnlock()
+	if !ok {
+		return r.fallback.Resolve(ctx, id, opts...)
+	}
+	return &resolution.ResolutionResult{Document: published.current(time.Now())}, nil
+}
+
+// Methods returns the methods of the fallback resolver; only DIDs of those can be published
+func (r *DIDRegistry) Methods() []did.Method {
+	return r.fallback.Methods()
+}
+
+// RotateKey makes a new key of the type of the entity's current one, which it signs with from now on, and publishes
+// its DID document with the new key to docs, the DIDWebHost of a did:web DID or a DIDRegistry otherwise. The replaced key stays in the document until grace has passed, so
+// the credentials it signed still verify until then. Issuers holding the old signer have to be made again with the
+// returned one; the entity's status lists are signed with the new key right away.
+func (e *Entity) RotateKey(docs DIDPublisher, grace time.Duration) (*jwx.Signer, error) {
+	if len(e.dids) == 0 || len(e.dids[0].Keys) == 0 {
+		return nil, fmt.Errorf("entity<%s> has no key to rotate", e.Name)
+	}
+	d := &e.dids[0]
+	current := &d.Keys[len(d.Keys)-1]
+	pubKey, err := e.keys.PublicKey(current.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	kt, err := keyTypeOf(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := e.keys.CreateKey(kt)
+	if err != nil {
+		return nil, err
+	}
+	kid := fmt.Sprintf("#key-%d", len(d.Keys)+1)
+	signer, err := managedJWXSigner(e.keys, d.ID, kid, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	retiredUntil := time.Now().Add(grace)
+	current.RetiredUntil = &retiredUntil
+	d.Keys = append(d.Keys, StoredKey{ID: kid, KeyID: keyID})
+	if err = e.PublishDIDDocument(docs); err != nil {
+		return nil, err
+	}
+	if e.statusRegistry != nil {
+		e.statusRegistry.setSigner(*signer)
+	}
+	example.WriteNote(fmt.Sprintf("%s rotated its key to %s; %s stays in its DID document until %s", e.Name, kid, current.ID, retiredUntil.Format(time.RFC3339)))
+	return signer, e.save()
+}
+
+// PublishDIDDocument publishes the DID document of the entity's first DID to docs: its current key, and the
+// keys it replaced that are still in their grace period. RotateKey, and NewEntity for did:web DIDs, do so
+// themselves; entities loaded with OpenEntity publish again to registries and hosts that do not outlive the process.
+func (e *Entity) PublishDIDDocument(docs DIDPublisher) error {
+	if len(e.dids) == 0 {
+		return fmt.Errorf("entity<%s> has no DID", e.Name)
+	}
+	d := e.dids[0]
+	now := time.Now()
+	published := PublishedDocument{
+		Document: did.Document{Context: did.KnownDIDContext, ID: d.ID},
+		Retired:  make(map[string]time.Time),
+	}
+	for i, k := range d.Keys {
+		if k.RetiredUntil != nil && !now.Before(*k.RetiredUntil) {
+			continue
+		}
+		pubKey, err := e.keys.PublicKey(k.KeyID)
+		if err != nil {
+			return err
+		}
+		pubJWK, err := jwx.PublicKeyToPublicKeyJWK(k.ID, pubKey)
+		if err != nil {
+			return errors.Wrapf(err, "converting public key of key<%s>", k.ID)
+		}
+		published.Document.VerificationMethod = append(published.Document.VerificationMethod, did.VerificationMethod{
+			ID:           k.ID,
+			Type:         cryptosuite.JSONWebKey2020Type,
+			Controller:   d.ID,
+			PublicKeyJWK: pubJWK,
+		})
+		// retired keys only verify what they signed before; the current key also authenticates
+		published.Document.AssertionMethod = append(published.Document.AssertionMethod, k.ID)
+		if i == len(d.Keys)-1 {
+			published.Document.Authentication = append(published.Document.Authentication, k.ID)
+		}
+		if k.RetiredUntil != nil {
+			published.Retired[k.ID] = *k.RetiredUntil
+		}
+	}
+	if err := docs.Publish(published); err != nil {
+		return err
+	}
+	example.WriteNote(fmt.Sprintf("DID document of %s published with %d keys", d.ID, len(published.Document.VerificationMethod)))
+	return nil
+}
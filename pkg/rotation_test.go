@@ -0,0 +1,196 @@
+package pkg
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+)
+
+// issueTestJWT issues a credential signed by signer to the student
+func issueTestJWT(t *testing.T, signer, student *jwx.Signer) string {
+	t.Helper()
+	issued, err := NewIssuer(*signer).Issue(SingleVCTemplate([]string{"G1"}), student.ID)
+	if err != nil {
+		t.Fatalf("issuing credential: %v", err)
+	}
+	return issued.JWT
+}
+
+func TestRotateKey(t *testing.T) {
+	university, oldSigner := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	registry := NewDIDRegistry(key.Resolver{})
+	oldCred := issueTestJWT(t, oldSigner, student)
+
+	const grace = 500 * time.Millisecond
+	newSigner, err := university.RotateKey(registry, grace)
+	if err != nil {
+		t.Fatalf("rotating key: %v", err)
+	}
+	if newSigner.ID != oldSigner.ID || newSigner.KID == oldSigner.KID {
+		t.Fatalf("expected a new key of DID<%s>, got %s%s", oldSigner.ID, newSigner.ID, newSigner.KID)
+	}
+	newCred := issueTestJWT(t, newSigner, student)
+	if _, err = verifyCredentialJWT(registry, oldCred, newVerifyOptions()); err != nil {
+		t.Fatalf("expected the credential of the retired key to verify within the grace period, got %v", err)
+	}
+	if _, err = verifyCredentialJWT(registry, newCred, newVerifyOptions()); err != nil {
+		t.Fatalf("expected the credential of the new key to verify, got %v", err)
+	}
+
+	time.Sleep(grace)
+	if _, err = verifyCredentialJWT(registry, oldCred, newVerifyOptions()); err == nil {
+		t.Fatal("expected the credential of the retired key not to verify after the grace period")
+	}
+	if _, err = verifyCredentialJWT(registry, newCred, newVerifyOptions()); err != nil {
+		t.Fatalf("expected the credential of the new key to verify, got %v", err)
+	}
+}
+
+func TestRotateKeyPersisted(t *testing.T) {
+	dir := t.TempDir()
+	_, student := newTestEntity(t, "Student")
+	open := func() *Entity {
+		store, err := NewFileWalletStore(filepath.Join(dir, "university.wallet"), testPassphrase)
+		if err != nil {
+			t.Fatalf("making store: %v", err)
+		}
+		keys, err := NewFileKeyManager(filepath.Join(dir, "university.keys"), testPassphrase)
+		if err != nil {
+			t.Fatalf("making key manager: %v", err)
+		}
+		e, err := OpenEntity("University", did.KeyMethod, store, WithKeyManager(keys))
+		if err != nil {
+			t.Fatalf("opening entity: %v", err)
+		}
+		return e
+	}
+	university := open()
+	oldSigner, err := university.Signer()
+	if err != nil {
+		t.Fatalf("getting signer: %v", err)
+	}
+	oldCred := issueTestJWT(t, oldSigner, student)
+	if _, err = university.RotateKey(NewDIDRegistry(key.Resolver{}), time.Hour); err != nil {
+		t.Fatalf("rotating key: %v", err)
+	}
+
+	// a registry that did not outlive the process gets the document with the retired key published again
+	reopened := open()
+	registry := NewDIDRegistry(key.Resolver{})
+	if err = reopened.PublishDIDDocument(registry); err != nil {
+		t.Fatalf("publishing DID document: %v", err)
+	}
+	newSigner, err := reopened.Signer()
+	if err != nil {
+		t.Fatalf("getting signer: %v", err)
+	}
+	if newSigner.KID == oldSigner.KID {
+		t.Fatalf("expected the rotated key to be restored, got %s", newSigner.KID)
+	}
+	for _, cred := range []string{oldCred, issueTestJWT(t, newSigner, student)} {
+		if _, err = verifyCredentialJWT(registry, cred, newVerifyOptions()); err != nil {
+			t.Fatalf("verifying credential: %v", err)
+		}
+	}
+}
+
+func TestPublishedDocumentCurrent(t *testing.T) {
+	now := time.Now()
+	published := PublishedDocument{
+		Document: did.Document{
+			ID: "did:example:university",
+			VerificationMethod: []did.VerificationMethod{
+				{ID: "#key-1"}, {ID: "#key-2"}, {ID: "#key-3"},
+			},
+			AssertionMethod: []did.VerificationMethodSet{"#key-1", "#key-2", "#key-3"},
+			Authentication:  []did.VerificationMethodSet{"#key-3"},
+		},
+		Retired: map[string]time.Time{
+			"#key-1": now.Add(-time.Hour),
+			"#key-2": now.Add(time.Hour),
+		},
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want []string
+	}{
+		{name: "both retired keys in their grace period", now: now.Add(-2 * time.Hour), want: []string{"#key-1", "#key-2", "#key-3"}},
+		{name: "grace period of the first key over", now: now, want: []string{"#key-2", "#key-3"}},
+		{name: "at the end of the grace period", now: now.Add(time.Hour), want: []string{"#key-3"}},
+		{name: "all grace periods over", now: now.Add(2 * time.Hour), want: []string{"#key-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := published.current(tt.now)
+			if len(doc.VerificationMethod) != len(tt.want) || len(doc.AssertionMethod) != len(tt.want) {
+				t.Fatalf("expected keys %v, got %d verification and %d assertion methods", tt.want, len(doc.VerificationMethod), len(doc.AssertionMethod))
+			}
+			for i, id := range tt.want {
+				if doc.VerificationMethod[i].ID != id || doc.AssertionMethod[i] != id {
+					t.Fatalf("expected keys %v, got %v", tt.want, doc.VerificationMethod)
+				}
+			}
+			if len(doc.Authentication) != 1 || doc.Authentication[0] != "#key-3" {
+				t.Fatalf("expected only the current key to authenticate, got %v", doc.Authentication)
+			}
+		})
+	}
+	if len(published.Document.VerificationMethod) != 3 {
+		t.Fatal("expected the published document to be left as it is")
+	}
+}
+
+func TestDIDWebHostRotation(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	host, err := NewDIDWebHost(srv.URL)
+	if err != nil {
+		t.Fatalf("making did:web host: %v", err)
+	}
+	srv.Config.Handler = host
+	var r resolution.Resolver = WebResolver{Client: srv.Client(), AllowHTTP: true}
+
+	university, err := NewEntity("Example University", did.WebMethod, WithDIDWebHost(host))
+	if err != nil {
+		t.Fatalf("making did:web entity: %v", err)
+	}
+	oldSigner, err := university.Signer()
+	if err != nil {
+		t.Fatalf("getting signer: %v", err)
+	}
+	if oldSigner.ID != host.DID("Example University") {
+		t.Fatalf("expected DID<%s>, got<%s>", host.DID("Example University"), oldSigner.ID)
+	}
+	_, student := newTestEntity(t, "Student")
+	oldCred := issueTestJWT(t, oldSigner, student)
+	if _, err = verifyCredentialJWT(r, oldCred, newVerifyOptions()); err != nil {
+		t.Fatalf("verifying credential of did:web issuer: %v", err)
+	}
+
+	newSigner, err := university.RotateKey(host, time.Hour)
+	if err != nil {
+		t.Fatalf("rotating key: %v", err)
+	}
+	for _, cred := range []string{oldCred, issueTestJWT(t, newSigner, student)} {
+		if _, err = verifyCredentialJWT(r, cred, newVerifyOptions()); err != nil {
+			t.Fatalf("verifying credential of did:web issuer: %v", err)
+		}
+	}
+
+	if _, err = r.Resolve(context.Background(), host.DID("Unknown University")); err == nil {
+		t.Fatal("expected a DID that is not hosted not to resolve")
+	}
+	if _, err = (WebResolver{Client: srv.Client()}).Resolve(context.Background(), oldSigner.ID); err == nil {
+		t.Fatal("expected did:web to be fetched over HTTPS unless HTTP is allowed")
+	}
+}
@@ -0,0 +1,608 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/goccy/go-json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+// SDJWTFormat is the claim format of SD-JWT VCs in presentation definitions and submissions
+const SDJWTFormat = "vc+sd-jwt"
+
+// Names used in SD-JWTs, see https://datatracker.ietf.org/doc/draft-ietf-oauth-selective-disclosure-jwt/
+const (
+	sdJWTSeparator = "~"
+	sdAlg          = "sha-256"
+	sdClaim        = "_sd"
+	sdAlgClaim     = "_sd_alg"
+	sdElementClaim = "..."
+	sdHashClaim    = "sd_hash"
+	vctClaim       = "vct"
+	statusClaim    = "status"
+	kbJWTType      = "kb+jwt"
+)
+
+// sdJWTRegisteredClaims are the claims of an SD-JWT VC which are not about the subject
+var sdJWTRegisteredClaims = []string{
+	jwt.IssuerKey, jwt.SubjectKey, jwt.IssuedAtKey, jwt.NotBeforeKey, jwt.ExpirationKey, jwt.JwtIDKey,
+	vctClaim, statusClaim, sdAlgClaim, "cnf",
+}
+
+// Disclosure reveals one selectively disclosable claim, or one element of an array claim, of an SD-JWT
+type Disclosure struct {
+	Salt string
+	// Name is the claim name; it is empty for an array element
+	Name  string
+	Value any
+	// Encoded is the base64url form carried in the SD-JWT, which the digest is taken over
+	Encoded string
+}
+
+// newDisclosure salts a claim, or an array element when name is empty, and encodes it
+func newDisclosure(name string, value any) (Disclosure, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Disclosure{}, err
+	}
+	d := Disclosure{Salt: base64.RawURLEncoding.EncodeToString(salt), Name: name, Value: value}
+	parts := []any{d.Salt, name, value}
+	if name == "" {
+		parts = []any{d.Salt, value}
+	}
+	dat, err := json.Marshal(parts)
+	if err != nil {
+		return Disclosure{}, err
+	}
+	d.Encoded = base64.RawURLEncoding.EncodeToString(dat)
+	return d, nil
+}
+
+// ParseDisclosure decodes a disclosure of an SD-JWT
+func ParseDisclosure(encoded string) (Disclosure, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Disclosure{}, errors.Wrap(err, "decoding disclosure")
+	}
+	var parts []any
+	if err = json.Unmarshal(dat, &parts); err != nil {
+		return Disclosure{}, errors.Wrap(err, "parsing disclosure")
+	}
+	d := Disclosure{Encoded: encoded}
+	var ok bool
+	switch len(parts) {
+	case 2:
+		d.Value = parts[1]
+	case 3:
+		d.Value = parts[2]
+		if d.Name, ok = parts[1].(string); !ok || d.Name == "" {
+			return Disclosure{}, errors.New("disclosure claim name must be a non-empty string")
+		}
+	default:
+		return Disclosure{}, fmt.Errorf("disclosure has %d parts, expected 2 or 3", len(parts))
+	}
+	if d.Salt, ok = parts[0].(string); !ok {
+		return Disclosure{}, errors.New("disclosure salt must be a string")
+	}
+	return d, nil
+}
+
+// Digest is the base64url SHA-256 digest of the disclosure the issuer signs in place of the claim
+func (d Disclosure) Digest() string {
+	return sdDigest(d.Encoded)
+}
+
+func sdDigest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// matches reports whether the disclosure is the one a holder chose, by claim name or by value. Role entries
+// such as {"value": "Teaching Assistant", "lang": "en"} are matched by their value.
+func (d Disclosure) matches(choice string) bool {
+	if d.Name != "" {
+		return d.Name == choice
+	}
+	switch v := d.Value.(type) {
+	case string:
+		return v == choice
+	case map[string]any:
+		return v["value"] == choice
+	}
+	return false
+}
+
+// SDJWT is an SD-JWT: the issuer-signed JWT, the disclosures that go with it and, once presented, the key
+// binding JWT (KB-JWT) of the holder
+type SDJWT struct {
+	IssuerJWT   string
+	Disclosures []Disclosure
+	KeyBinding  string
+}
+
+// ParseSDJWT splits an SD-JWT of the form <issuer JWT>~<disclosure>~...~<KB-JWT>, where the KB-JWT is empty
+// until the holder presents it
+func ParseSDJWT(s string) (*SDJWT, error) {
+	parts := strings.Split(s, sdJWTSeparator)
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, errors.New("SD-JWT must be an issuer JWT followed by ~")
+	}
+	sd := SDJWT{IssuerJWT: parts[0], KeyBinding: parts[len(parts)-1]}
+	for _, encoded := range parts[1 : len(parts)-1] {
+		d, err := ParseDisclosure(encoded)
+		if err != nil {
+			return nil, err
+		}
+		sd.Disclosures = append(sd.Disclosures, d)
+	}
+	return &sd, nil
+}
+
+// String encodes the SD-JWT in its compact form
+func (s SDJWT) String() string {
+	return s.withoutKeyBinding() + s.KeyBinding
+}
+
+// withoutKeyBinding is the part of the SD-JWT the KB-JWT's sd_hash is taken over
+func (s SDJWT) withoutKeyBinding() string {
+	var b strings.Builder
+	b.WriteString(s.IssuerJWT)
+	b.WriteString(sdJWTSeparator)
+	for _, d := range s.Disclosures {
+		b.WriteString(d.Encoded)
+		b.WriteString(sdJWTSeparator)
+	}
+	return b.String()
+}
+
+// IssuedSDJWT is the result of an SD-JWT issuance: the SD-JWT with every disclosure, for the holder to keep
+type IssuedSDJWT struct {
+	ID          string
+	SDJWT       string
+	Disclosures []Disclosure
+}
+
+// IssueSDJWT Makes a credential from the template for recipientDID and signs it as an SD-JWT VC. The subject
+// claims named in disclosable are selectively disclosable: an array claim gets one disclosure per element, so
+// e.g. each role can be shown on its own, and any other claim a single disclosure. The other claims are always
+// visible. The holder is bound by the sub claim: presentations need a KB-JWT signed by a key of that DID.
+func (i *Issuer) IssueSDJWT(t CredentialTemplate, recipientDID string, disclosable []string, opts ...IssueOption) (*IssuedSDJWT, error) {
+	cred, err := i.newCredential(t, recipientDID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	validFrom, err := time.Parse(time.RFC3339, cred.IssuanceDate)
+	if err != nil {
+		return nil, err
+	}
+	types := t.types()
+	claims := map[string]any{
+		jwt.IssuerKey:    i.DID(),
+		jwt.SubjectKey:   recipientDID,
+		jwt.JwtIDKey:     cred.ID,
+		jwt.IssuedAtKey:  validFrom.Unix(),
+		jwt.NotBeforeKey: validFrom.Unix(),
+		vctClaim:         types[len(types)-1],
+		sdAlgClaim:       sdAlg,
+	}
+	if cred.ExpirationDate != "" {
+		validUntil, err := time.Parse(time.RFC3339, cred.ExpirationDate)
+		if err != nil {
+			return nil, err
+		}
+		claims[jwt.ExpirationKey] = validUntil.Unix()
+	}
+	if cred.CredentialStatus != nil {
+		claims[statusClaim] = cred.CredentialStatus
+	}
+
+	issued := IssuedSDJWT{ID: cred.ID}
+	var digests []string
+	for name, value := range cred.CredentialSubject {
+		if name == "id" {
+			continue
+		}
+		if !util.Contains(name, disclosable) {
+			claims[name] = value
+			continue
+		}
+		if elements, ok := value.([]any); ok {
+			hidden := make([]any, 0, len(elements))
+			for _, element := range elements {
+				d, err := newDisclosure("", element)
+				if err != nil {
+					return nil, err
+				}
+				issued.Disclosures = append(issued.Disclosures, d)
+				hidden = append(hidden, map[string]any{sdElementClaim: d.Digest()})
+			}
+			claims[name] = hidden
+			continue
+		}
+		d, err := newDisclosure(name, value)
+		if err != nil {
+			return nil, err
+		}
+		issued.Disclosures = append(issued.Disclosures, d)
+		digests = append(digests, d.Digest())
+	}
+	for _, name := range disclosable {
+		if _, ok := cred.CredentialSubject[name]; !ok {
+			return nil, fmt.Errorf("disclosable claim<%s> is not in the credential subject", name)
+		}
+	}
+	if len(digests) > 0 {
+		// sorted so the digests do not give away the order of the claims
+		sort.Strings(digests)
+		claims[sdClaim] = digests
+	}
+
+	signed, err := signTypedJWT(i.signer, SDJWTFormat, claims)
+	if err != nil {
+		return nil, err
+	}
+	issued.SDJWT = SDJWT{IssuerJWT: signed, Disclosures: issued.Disclosures}.String()
+
+	example.WriteNote(fmt.Sprintf("SD-JWT VC issued from %s to %s with %d disclosures", i.DID(), recipientDID, len(issued.Disclosures)))
+	return &issued, nil
+}
+
+// BuildSingleSDJWTWithGroups is BuildSingleVCWithGroups issuing an SD-JWT VC in which every role is disclosed
+// on its own
+func BuildSingleSDJWTWithGroups(signer jwx.Signer, universityDID, recipientDID string, groups []string, opts ...IssueOption) (credID string, cred string, err error) {
+	issuer, err := builderIssuer(signer, universityDID)
+	if err != nil {
+		return "", "", err
+	}
+	issued, err := issuer.IssueSDJWT(SingleVCTemplate(groups), recipientDID, []string{"roles"}, opts...)
+	if err != nil {
+		return "", "", err
+	}
+	return issued.ID, issued.SDJWT, nil
+}
+
+// PresentSDJWT answers a presentation request with an SD-JWT, keeping only the disclosures chosen by claim name
+// or value (see Disclosure) and binding it to the request with a KB-JWT that carries the requester as audience
+// and the request's nonce. Every choice must match a disclosure.
+func PresentSDJWT(presentationRequestJWT string, requestVerifier jwx.Verifier, signer jwx.Signer, sdJWT string, disclose ...string) ([]byte, error) {
+	req, err := parsePresentationRequest(presentationRequestJWT, requestVerifier)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := ParseSDJWT(sdJWT)
+	if err != nil {
+		return nil, err
+	}
+	all := len(sd.Disclosures)
+	var kept []Disclosure
+	for _, choice := range disclose {
+		found := false
+		for _, d := range sd.Disclosures {
+			if d.matches(choice) {
+				kept = append(kept, d)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("SD-JWT has no disclosure for<%s>", choice)
+		}
+	}
+	sd.Disclosures = kept
+
+	sd.KeyBinding, err = signKeyBinding(signer, req.requester, req.nonce, *sd)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing key binding JWT")
+	}
+	example.WriteNote(fmt.Sprintf("Holder disclosed %d of %d claims in the SD-JWT", len(kept), all))
+	return []byte(sd.String()), nil
+}
+
+// signKeyBinding signs the KB-JWT binding an SD-JWT presentation to the holder's key and to one request
+func signKeyBinding(signer jwx.Signer, audience, nonce string, sd SDJWT) (string, error) {
+	return signTypedJWT(signer, kbJWTType, map[string]any{
+		jwt.AudienceKey:          audience,
+		jwt.IssuedAtKey:          time.Now().Unix(),
+		credential.NonceProperty: nonce,
+		sdHashClaim:              sdDigest(sd.withoutKeyBinding()),
+	})
+}
+
+// signTypedJWT signs claims as a JWT whose header carries typ and the signer's kid
+func signTypedJWT(signer jwx.Signer, typ string, claims map[string]any) (string, error) {
+	token := jwt.New()
+	for k, v := range claims {
+		if err := token.Set(k, v); err != nil {
+			return "", errors.Wrapf(err, "setting %s", k)
+		}
+	}
+	hdrs := jws.NewHeaders()
+	if err := hdrs.Set(jws.TypeKey, typ); err != nil {
+		return "", err
+	}
+	if err := hdrs.Set(jws.KeyIDKey, signer.KID); err != nil {
+		return "", err
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.SignatureAlgorithm(signer.ALG), signer.PrivateKey, jws.WithProtectedHeaders(hdrs)))
+	return string(signed), err
+}
+
+// VerifySDJWTPresentation is VerifyPresentation for an SD-JWT VC presented with PresentSDJWT. It checks:
+//  1. The issuer's signature over the SD-JWT and its validity window
+//  2. That every disclosure was signed by the issuer, by its digest
+//  3. The KB-JWT: signed by a key of the subject DID, addressed to audience, over this SD-JWT and its
+//     disclosures (sd_hash)
+//  4. The trusted issuers, the credential status and the presentation definition, as configured
+//  5. Last, that the KB-JWT's nonce was issued by the replay cache, if one is configured
+//
+// The presented credential is the SD-JWT with the disclosed claims only; Presentation is nil as there is no VP.
+func VerifySDJWTPresentation(r resolution.Resolver, presentation []byte, audience string, opts ...VerifyOption) (*VerifiedPresentation, error) {
+	o := newVerifyOptions(opts...)
+	if r == nil {
+		return nil, errors.New("resolver cannot be empty")
+	}
+	sd, err := ParseSDJWT(string(presentation))
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := jws.Parse([]byte(sd.IssuerJWT))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing SD-JWT")
+	}
+	if len(msg.Signatures()) != 1 {
+		return nil, errors.Wrapf(ErrInvalidSignature, "SD-JWT has %d signatures, expected 1", len(msg.Signatures()))
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	token, err := jwt.Parse([]byte(sd.IssuerJWT), jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing SD-JWT")
+	}
+	if err = checkValidityWindow(token, o); err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", token.JwtID())
+	}
+	if err = verifyIssuerSignature(r, sd.IssuerJWT, token.Issuer(), headers.KeyID(), token.JwtID()); err != nil {
+		return nil, err
+	}
+
+	var payload map[string]any
+	if err = json.Unmarshal(msg.Payload(), &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing SD-JWT payload")
+	}
+	if alg, _ := payload[sdAlgClaim].(string); alg != sdAlg {
+		return nil, fmt.Errorf("credential<%s>: unsupported %s<%v>", token.JwtID(), sdAlgClaim, payload[sdAlgClaim])
+	}
+	disclosed, err := applyDisclosures(payload, sd.Disclosures)
+	if err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", token.JwtID())
+	}
+	cred, err := disclosedCredential(disclosed.(map[string]any), token)
+	if err != nil {
+		return nil, err
+	}
+
+	holder := token.Subject()
+	kbToken, err := verifyKeyBinding(r, *sd, holder, audience, o)
+	if err != nil {
+		return nil, err
+	}
+
+	vc := VerifiedCredential{JWT: sd.IssuerJWT, Token: token, Credential: cred}
+	if o.trusted != nil {
+		if err = o.trusted.CheckCredential(vc.Credential); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkCredentialStatus(r, vc, o); err != nil {
+		return nil, errors.Wrapf(err, "checking status of credential<%s>", vc.Credential.ID)
+	}
+	if o.definition != nil {
+		if err = checkDisclosedDefinition(*o.definition, vc, SDJWTFormat, headers.Algorithm().String()); err != nil {
+			return nil, err
+		}
+	}
+	nonce, _ := kbToken.Get(credential.NonceProperty)
+	nonceStr, _ := nonce.(string)
+	if err = o.redeem(nonceStr); err != nil {
+		return nil, err
+	}
+	return &VerifiedPresentation{Holder: holder, Token: kbToken, Credentials: []VerifiedCredential{vc}}, nil
+}
+
+// verifyKeyBinding checks the KB-JWT of an SD-JWT presentation
+func verifyKeyBinding(r resolution.Resolver, sd SDJWT, holder, audience string, o verifyOptions) (jwt.Token, error) {
+	if sd.KeyBinding == "" {
+		return nil, errors.Wrap(ErrHolderBindingFailed, "SD-JWT presented without a key binding JWT")
+	}
+	if holder == "" {
+		return nil, errors.Wrap(ErrHolderBindingFailed, "SD-JWT has no sub to bind the holder")
+	}
+	msg, err := jws.Parse([]byte(sd.KeyBinding))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing key binding JWT")
+	}
+	if len(msg.Signatures()) != 1 {
+		return nil, errors.Wrapf(ErrHolderBindingFailed, "key binding JWT has %d signatures, expected 1", len(msg.Signatures()))
+	}
+	if typ := msg.Signatures()[0].ProtectedHeaders().Type(); typ != kbJWTType {
+		return nil, errors.Wrapf(ErrHolderBindingFailed, "key binding JWT has typ<%s>, expected<%s>", typ, kbJWTType)
+	}
+	if err = verifyHolderSignature(r, sd.KeyBinding, holder); err != nil {
+		return nil, errors.Wrap(err, "key binding JWT")
+	}
+	kbToken, err := jwt.Parse([]byte(sd.KeyBinding), jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing key binding JWT")
+	}
+	if !util.Contains(audience, kbToken.Audience()) {
+		return nil, errors.Wrapf(ErrAudienceMismatch, "expected [%s], got %s", audience, kbToken.Audience())
+	}
+	if iat := kbToken.IssuedAt(); iat.IsZero() || o.clock().Add(o.skew).Before(iat) {
+		return nil, errors.Wrapf(ErrHolderBindingFailed, "key binding JWT issued at %s", iat.Format(time.RFC3339))
+	}
+	sdHash, _ := kbToken.Get(sdHashClaim)
+	if sdHash != sdDigest(sd.withoutKeyBinding()) {
+		return nil, errors.Wrap(ErrHolderBindingFailed, "key binding JWT was made for other disclosures")
+	}
+	return kbToken, nil
+}
+
+// applyDisclosures puts the disclosed claims and array elements back in place of their digests and drops the
+// undisclosed ones. A disclosure whose digest the issuer did not sign, or that is given twice, fails with
+// ErrInvalidSignature.
+func applyDisclosures(payload map[string]any, disclosures []Disclosure) (any, error) {
+	byDigest := make(map[string]Disclosure, len(disclosures))
+	for _, d := range disclosures {
+		digest := d.Digest()
+		if _, ok := byDigest[digest]; ok {
+			return nil, errors.Wrap(ErrInvalidSignature, "disclosure given twice")
+		}
+		byDigest[digest] = d
+	}
+	used := make(map[string]bool, len(disclosures))
+
+	var walk func(v any) (any, error)
+	walk = func(v any) (any, error) {
+		switch value := v.(type) {
+		case map[string]any:
+			out := make(map[string]any, len(value))
+			for k, child := range value {
+				if k == sdClaim || k == sdAlgClaim {
+					continue
+				}
+				w, err := walk(child)
+				if err != nil {
+					return nil, err
+				}
+				out[k] = w
+			}
+			digests, _ := value[sdClaim].([]any)
+			for _, digest := range digests {
+				d, ok := byDigest[fmt.Sprint(digest)]
+				if !ok {
+					continue
+				}
+				if d.Name == "" {
+					return nil, errors.Wrap(ErrInvalidSignature, "array element disclosure used for a claim")
+				}
+				if _, exists := out[d.Name]; exists {
+					return nil, errors.Wrapf(ErrInvalidSignature, "disclosed claim<%s> is already in the SD-JWT", d.Name)
+				}
+				used[d.Encoded] = true
+				w, err := walk(d.Value)
+				if err != nil {
+					return nil, err
+				}
+				out[d.Name] = w
+			}
+			return out, nil
+		case []any:
+			out := make([]any, 0, len(value))
+			for _, element := range value {
+				if ref, ok := element.(map[string]any); ok && len(ref) == 1 && ref[sdElementClaim] != nil {
+					d, ok := byDigest[fmt.Sprint(ref[sdElementClaim])]
+					if !ok {
+						continue
+					}
+					if d.Name != "" {
+						return nil, errors.Wrapf(ErrInvalidSignature, "claim disclosure<%s> used for an array element", d.Name)
+					}
+					used[d.Encoded] = true
+					element = d.Value
+				}
+				w, err := walk(element)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, w)
+			}
+			return out, nil
+		}
+		return v, nil
+	}
+
+	out, err := walk(payload)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range disclosures {
+		if !used[d.Encoded] {
+			return nil, errors.Wrap(ErrInvalidSignature, "disclosure is not signed by the issuer")
+		}
+	}
+	return out, nil
+}
+
+// disclosedCredential turns the disclosed claims of an SD-JWT VC or a BBS credential into a VerifiableCredential,
+// so access policies and trusted issuers treat it like the JWT VCs. The subject is the sub claim.
+func disclosedCredential(claims map[string]any, token jwt.Token) (*credential.VerifiableCredential, error) {
+	subject := make(map[string]any, len(claims))
+	for k, v := range claims {
+		if !util.Contains(k, sdJWTRegisteredClaims) {
+			subject[k] = v
+		}
+	}
+	subject["id"] = token.Subject()
+	vct, _ := claims[vctClaim].(string)
+	if vct == "" {
+		return nil, fmt.Errorf("credential<%s> has no %s", token.JwtID(), vctClaim)
+	}
+	cred := credential.VerifiableCredential{
+		Context:           []any{"https://www.w3.org/2018/credentials/v1"},
+		ID:                token.JwtID(),
+		Type:              []any{credential.VerifiableCredentialType, vct},
+		Issuer:            token.Issuer(),
+		IssuanceDate:      token.NotBefore().Format(time.RFC3339),
+		CredentialSubject: subject,
+		CredentialStatus:  claims[statusClaim],
+	}
+	if exp := token.Expiration(); !exp.IsZero() {
+		cred.ExpirationDate = exp.Format(time.RFC3339)
+	}
+	return &cred, nil
+}
+
+// checkDisclosedDefinition evaluates a presented SD-JWT VC or BBS credential, in the given claim format, against
+// the verifier's presentation definition. There is no presentation_submission: every input descriptor the
+// disclosed claims satisfy is answered, and those must meet the submission requirements. Field paths see the
+// credential as a JWT VC would show it, e.g. $.iss or $.vc.credentialSubject.roles.
+func checkDisclosedDefinition(def exchange.PresentationDefinition, vc VerifiedCredential, format, alg string) error {
+	credJSON, err := json.Marshal(vc.Credential)
+	if err != nil {
+		return err
+	}
+	var vcClaims map[string]any
+	if err = json.Unmarshal(credJSON, &vcClaims); err != nil {
+		return err
+	}
+	claims := map[string]any{
+		jwt.IssuerKey:            vc.Token.Issuer(),
+		jwt.SubjectKey:           vc.Token.Subject(),
+		jwt.JwtIDKey:             vc.Token.JwtID(),
+		credential.VCJWTProperty: vcClaims,
+	}
+	answered := make(map[int]bool)
+	for i, desc := range def.InputDescriptors {
+		if formatAccepts(descriptorFormat(def, desc), format, alg) && unmatchedField(desc, claims) == nil {
+			answered[i] = true
+		}
+	}
+	if err = checkSubmissionRequirements(def, answered); err != nil {
+		return errors.Wrapf(ErrSubmissionMismatch, "%s credential<%s>: %s", format, vc.Credential.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+)
+
+// newTestRequest signs a presentation request from verifier to holder with a nonce of cache, returning it with
+// the verifier the holder checks it with
+func newTestRequest(t *testing.T, verifier, holder *jwx.Signer, cache *ReplayCache) (string, jwx.Verifier) {
+	t.Helper()
+	def := exchange.PresentationDefinition{ID: "test", InputDescriptors: []exchange.InputDescriptor{{ID: "id-1"}}}
+	req, err := MakePresentationRequest(*verifier, def, holder.ID, cache.NewChallenge(DefaultRequestTTL))
+	if err != nil {
+		t.Fatalf("making presentation request: %v", err)
+	}
+	requestVerifier, err := verifier.ToVerifier(holder.ID)
+	if err != nil {
+		t.Fatalf("making request verifier: %v", err)
+	}
+	return string(req), *requestVerifier
+}
+
+// presentTestSDJWT issues an SD-JWT with every role disclosable to the student and presents the TA role to the
+// employer, returning the presentation and the employer's replay cache
+func presentTestSDJWT(t *testing.T, university, student, employer *jwx.Signer) (string, *ReplayCache) {
+	t.Helper()
+	_, sdJWT, err := BuildSingleSDJWTWithGroups(*university, university.ID, student.ID, []string{"G1", TeachingAssistantRole, "G3"})
+	if err != nil {
+		t.Fatalf("issuing SD-JWT: %v", err)
+	}
+	cache := NewReplayCache()
+	req, requestVerifier := newTestRequest(t, employer, student, cache)
+	presentation, err := PresentSDJWT(req, requestVerifier, *student, sdJWT, TeachingAssistantRole)
+	if err != nil {
+		t.Fatalf("presenting SD-JWT: %v", err)
+	}
+	return string(presentation), cache
+}
+
+func TestSDJWTRoundTrip(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	presentation, cache := presentTestSDJWT(t, university, student, employer)
+
+	verified, err := VerifySDJWTPresentation(key.Resolver{}, []byte(presentation), employer.ID, WithReplayCache(cache))
+	if err != nil {
+		t.Fatalf("verifying SD-JWT presentation: %v", err)
+	}
+	if verified.Holder != student.ID {
+		t.Fatalf("expected holder<%s>, got<%s>", student.ID, verified.Holder)
+	}
+	roles, _ := verified.Credentials[0].Credential.CredentialSubject["roles"].([]any)
+	if len(roles) != 1 {
+		t.Fatalf("expected only the disclosed role, got %v", roles)
+	}
+	if decision := ValidateSDJWTAccess(employer.ID, key.Resolver{}, []byte(presentation), TeachingAssistantPolicy(university.ID)); !decision.Allowed {
+		t.Fatalf("expected access, got %v", decision.Err())
+	}
+
+	_, err = VerifySDJWTPresentation(key.Resolver{}, []byte(presentation), employer.ID, WithReplayCache(cache))
+	if !errors.Is(err, ErrPresentationReplayed) {
+		t.Fatalf("expected %v, got %v", ErrPresentationReplayed, err)
+	}
+}
+
+func TestSDJWTTampered(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	_, other := newTestEntity(t, "Other")
+	presentation, _ := presentTestSDJWT(t, university, student, employer)
+	sd, err := ParseSDJWT(presentation)
+	if err != nil {
+		t.Fatalf("parsing SD-JWT: %v", err)
+	}
+
+	forged, err := newDisclosure("roles", "Professor")
+	if err != nil {
+		t.Fatalf("making disclosure: %v", err)
+	}
+	withForged := *sd
+	withForged.Disclosures = append([]Disclosure{forged}, sd.Disclosures...)
+
+	withoutDisclosures := *sd
+	withoutDisclosures.Disclosures = nil
+
+	withoutKeyBinding := *sd
+	withoutKeyBinding.KeyBinding = ""
+
+	otherKeyBinding := *sd
+	otherKeyBinding.KeyBinding, err = signKeyBinding(*other, employer.ID, "nonce", *sd)
+	if err != nil {
+		t.Fatalf("signing key binding: %v", err)
+	}
+
+	issuerParts := strings.Split(sd.IssuerJWT, ".")
+	otherSignature := *sd
+	otherSignature.IssuerJWT = issuerParts[0] + "." + issuerParts[1] + "." + strings.Split(otherKeyBinding.KeyBinding, ".")[2]
+
+	tests := []struct {
+		name         string
+		presentation string
+		audience     string
+		wantErr      error
+	}{
+		{name: "disclosure the issuer did not sign", presentation: withForged.String(), audience: employer.ID, wantErr: ErrInvalidSignature},
+		{name: "disclosures removed after binding", presentation: withoutDisclosures.String(), audience: employer.ID, wantErr: ErrHolderBindingFailed},
+		{name: "no key binding", presentation: withoutKeyBinding.String(), audience: employer.ID, wantErr: ErrHolderBindingFailed},
+		{name: "key binding by another key", presentation: otherKeyBinding.String(), audience: employer.ID, wantErr: ErrHolderBindingFailed},
+		{name: "issuer signature replaced", presentation: otherSignature.String(), audience: employer.ID, wantErr: ErrInvalidSignature},
+		{name: "other audience", presentation: presentation, audience: other.ID, wantErr: ErrAudienceMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifySDJWTPresentation(key.Resolver{}, []byte(tt.presentation), tt.audience)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/status"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrCredentialRevoked is returned for a credential whose revocation bit is set
+	ErrCredentialRevoked = errors.New("credential has been revoked")
+	// ErrCredentialSuspended is returned for a credential whose suspension bit is set
+	ErrCredentialSuspended = errors.New("credential is suspended")
+)
+
+// statusPurposes are the lists every StatusRegistry keeps; each credential gets an entry in both
+var statusPurposes = []status.StatusPurpose{status.StatusRevocation, status.StatusSuspension}
+
+// StatusRegistry holds the StatusList2021 bitstring lists an issuer keeps for the credentials it issues.
+// A credential gets the same index in the revocation and the suspension list, so it can be revoked for good
+// or suspended and reinstated later.
+type StatusRegistry struct {
+	mux     sync.Mutex
+	signer  jwx.Signer
+	baseURL string
+	indices map[string]int // credential id -> status list index
+	set     map[status.StatusPurpose]map[int]bool
+}
+
+// NewStatusRegistry creates the registry of the issuer signing with signer. The lists are published
+// under baseURL, one per purpose (e.g. <baseURL>/revocation); serve them with the registry's ServeHTTP.
+func NewStatusRegistry(signer jwx.Signer, baseURL string) *StatusRegistry {
+	s := StatusRegistry{
+		signer:  signer,
+		baseURL: baseURL,
+		indices: make(map[string]int),
+		set:     make(map[status.StatusPurpose]map[int]bool),
+	}
+	for _, purpose := range statusPurposes {
+		s.set[purpose] = make(map[int]bool)
+	}
+	return &s
+}
+
+// ListURL returns where the status list credential for purpose is published
+func (s *StatusRegistry) ListURL(purpose status.StatusPurpose) string {
+	return s.baseURL + "/" + string(purpose)
+}
+
+// allocate reserves an index for credID and returns its credentialStatus entries
+func (s *StatusRegistry) allocate(credID string) ([]any, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.indices[credID]; ok {
+		return nil, fmt.Errorf("credential<%s> already has a status list entry", credID)
+	}
+	index := len(s.indices)
+	s.indices[credID] = index
+
+	var entries []any
+	for _, purpose := range statusPurposes {
+		entries = append(entries, status.StatusList2021Entry{
+			ID:                   fmt.Sprintf("%s#%d", s.ListURL(purpose), index),
+			Type:                 status.StatusList2021EntryType,
+			StatusPurpose:        purpose,
+			StatusListIndex:      strconv.Itoa(index),
+			StatusListCredential: s.ListURL(purpose),
+		})
+	}
+	return entries, nil
+}
+
+func (s *StatusRegistry) setBit(credID string, purpose status.StatusPurpose, value bool) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	index, ok := s.indices[credID]
+	if !ok {
+		return fmt.Errorf("credential<%s> has no status list entry", credID)
+	}
+	if value {
+		s.set[purpose][index] = true
+	} else {
+		delete(s.set[purpose], index)
+	}
+	return nil
+}
+
+// Revoke sets the revocation bit of a credential issued with WithStatus
+func (s *StatusRegistry) Revoke(credID string) error {
+	return s.setBit(credID, status.StatusRevocation, true)
+}
+
+// Suspend sets the suspension bit of a credential issued with WithStatus
+func (s *StatusRegistry) Suspend(credID string) error {
+	return s.setBit(credID, status.StatusSuspension, true)
+}
+
+// Reinstate clears the suspension bit of a credential
+func (s *StatusRegistry) Reinstate(credID string) error {
+	return s.setBit(credID, status.StatusSuspension, false)
+}
+
+// setSigner makes the registry sign its lists with signer, a new key of the same issuer
+func (s *StatusRegistry) setSigner(signer jwx.Signer) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.signer = signer
+}
+
+// StatusListCredential builds and signs the current status list credential for purpose as a JWT
+func (s *StatusRegistry) StatusListCredential(purpose status.StatusPurpose) (string, error) {
+	s.mux.Lock()
+	bits, ok := s.set[purpose]
+	if !ok {
+		s.mux.Unlock()
+		return "", fmt.Errorf("unsupported status purpose<%s>", purpose)
+	}
+	// the SDK generates the bitstring from the entries of the credentials whose bit is set
+	var setCreds []credential.VerifiableCredential
+	for index := range bits {
+		setCreds = append(setCreds, credential.VerifiableCredential{
+			ID: fmt.Sprintf("%s#%d", s.ListURL(purpose), index),
+			CredentialStatus: status.StatusList2021Entry{
+				ID:                   fmt.Sprintf("%s#%d", s.ListURL(purpose), index),
+				Type:                 status.StatusList2021EntryType,
+				StatusPurpose:        purpose,
+				StatusListIndex:      strconv.Itoa(index),
+				StatusListCredential: s.ListURL(purpose),
+			},
+		})
+	}
+	signer := s.signer
+	s.mux.Unlock()
+
+	listCred, err := status.GenerateStatusList2021Credential(s.ListURL(purpose), signer.ID, purpose, setCreds)
+	if err != nil {
+		return "", err
+	}
+	signed, err := credential.SignVerifiableCredentialJWT(signer, *listCred)
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
+
+// FetchStatusList lets the registry act as a StatusFetcher for verifiers running in the same process
+func (s *StatusRegistry) FetchStatusList(url string) (string, error) {
+	for _, purpose := range statusPurposes {
+		if url == s.ListURL(purpose) {
+			return s.StatusListCredential(purpose)
+		}
+	}
+	return "", fmt.Errorf("status list<%s> not found", url)
+}
+
+// ServeHTTP publishes the status list credentials; the last path element selects the purpose
+func (s *StatusRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	purpose := status.StatusPurpose(path.Base(r.URL.Path))
+	if _, ok := s.set[purpose]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	listJWT, err := s.StatusListCredential(purpose)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwt")
+	_, _ = io.WriteString(w, listJWT)
+}
+
+// StatusFetcher retrieves the status list credential JWT published at a statusListCredential URL
+type StatusFetcher interface {
+	FetchStatusList(url string) (string, error)
+}
+
+// HTTPStatusFetcher fetches status list credentials over HTTP; it is the verifier's default
+type HTTPStatusFetcher struct {
+	Client *http.Client
+}
+
+// FetchStatusList GETs the status list credential at url
+func (f HTTPStatusFetcher) FetchStatusList(url string) (string, error) {
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", errors.Wrapf(err, "fetching status list<%s>", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching status list<%s>: unexpected status %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading status list<%s>", url)
+	}
+	return string(body), nil
+}
+
+// statusEntries returns the StatusList2021 entries in a credentialStatus, which may be one entry or a list
+func statusEntries(credStatus any) ([]status.StatusList2021Entry, error) {
+	if credStatus == nil {
+		return nil, nil
+	}
+	items, ok := credStatus.([]any)
+	if !ok {
+		items = []any{credStatus}
+	}
+	var entries []status.StatusList2021Entry
+	for _, item := range items {
+		dat, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var entry status.StatusList2021Entry
+		if err = json.Unmarshal(dat, &entry); err != nil {
+			return nil, errors.Wrap(err, "parsing credentialStatus")
+		}
+		if entry.Type != status.StatusList2021EntryType {
+			return nil, fmt.Errorf("unsupported credentialStatus type<%s>", entry.Type)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// checkCredentialStatus fetches the status lists a credential points to, verifies they were signed by the
+// credential's issuer and fails with ErrCredentialRevoked or ErrCredentialSuspended when its bit is set
+func checkCredentialStatus(r resolution.Resolver, vc VerifiedCredential, o verifyOptions) error {
+	entries, err := statusEntries(vc.Credential.CredentialStatus)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		listJWT, err := o.statusFetcher.FetchStatusList(entry.StatusListCredential)
+		if err != nil {
+			return err
+		}
+		list, err := verifyCredentialJWT(r, listJWT, o)
+		if err != nil {
+			return errors.Wrapf(err, "verifying status list<%s>", entry.StatusListCredential)
+		}
+		if list.Token.Issuer() != vc.Token.Issuer() {
+			return fmt.Errorf("status list<%s> issued by %s, not by the credential issuer %s",
+				entry.StatusListCredential, list.Token.Issuer(), vc.Token.Issuer())
+		}
+
+		isSet, err := status.ValidateCredentialInStatusList(credential.VerifiableCredential{
+			ID:               vc.Credential.ID,
+			CredentialStatus: entry,
+		}, *list.Credential)
+		if err != nil {
+			return err
+		}
+		if !isSet {
+			continue
+		}
+		switch entry.StatusPurpose {
+		case status.StatusRevocation:
+			return ErrCredentialRevoked
+		case status.StatusSuspension:
+			return ErrCredentialSuspended
+		default:
+			return fmt.Errorf("credential has status<%s>", entry.StatusPurpose)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/example"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrWalletLocked is returned when a stored wallet cannot be decrypted with the passphrase given, or was tampered with
+var ErrWalletLocked = errors.New("wallet cannot be decrypted with this passphrase")
+
+// WalletStore keeps an Entity's wallet between runs, see OpenEntity
+type WalletStore interface {
+	// Load returns the stored wallet, or nil if nothing was stored yet
+	Load() (*WalletContents, error)
+	// Save replaces the stored wallet
+	Save(contents WalletContents) error
+}
+
+// WalletContents is what a WalletStore keeps: the entity's DIDs with the ids of their keys, its credentials in the
+// order they were added and the openings of its group commitment VCs. The private keys stay in the KeyManager.
+type WalletContents struct {
+	Name          string                    `json:"name"`
+	DIDs          []StoredDID               `json:"dids"`
+	Credentials   []StoredCredential        `json:"credentials,omitempty"`
+	GroupOpenings map[string][]GroupOpening `json:"groupOpenings,omitempty"`
+}
+
+// StoredDID is a DID of the wallet with its keys
+type StoredDID struct {
+	ID   string      `json:"id"`
+	Keys []StoredKey `json:"keys"`
+}
+
+// StoredKey is a key of a DID: its key id in the DID document and the id the KeyManager keeps it under.
+// RetiredUntil is set once RotateKey replaced the key, to the end of its grace period.
+type StoredKey struct {
+	ID           string     `json:"id"`
+	KeyID        string     `json:"keyId"`
+	RetiredUntil *time.Time `json:"retiredUntil,omitempty"`
+}
+
+// StoredCredential is a credential of the wallet, a JWT or JSON-LD
+type StoredCredential struct {
+	ID         string `json:"id"`
+	Credential string `json:"credential"`
+}
+
+// OpenEntity is NewEntity for an entity whose wallet is kept in store. A stored wallet is loaded as it was saved,
+// and its keys have to be in the entity's KeyManager; otherwise the entity gets a new DID made with didMethod,
+// which is saved right away. Credentials added afterwards are saved as they are added.
+func OpenEntity(name string, didMethod did.Method, store WalletStore, opts ...EntityOption) (*Entity, error) {
+	contents, err := store.Load()
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading wallet of entity<%s>", name)
+	}
+	if contents == nil {
+		e, err := NewEntity(name, didMethod, opts...)
+		if err != nil {
+			return nil, err
+		}
+		e.store = store
+		if err = e.save(); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	e, _ := newEntity(name, opts...)
+	for _, d := range contents.DIDs {
+		if err = e.wallet.AddDID(d.ID); err != nil {
+			return nil, errors.Wrapf(err, "restoring DID<%s>", d.ID)
+		}
+		for _, k := range d.Keys {
+			if _, err = e.keys.PublicKey(k.KeyID); err != nil {
+				return nil, errors.Wrapf(err, "restoring key<%s>", k.ID)
+			}
+		}
+		e.dids = append(e.dids, d)
+	}
+	for _, c := range contents.Credentials {
+		if err = e.AddCredential(c.ID, c.Credential); err != nil {
+			return nil, errors.Wrapf(err, "restoring credential<%s>", c.ID)
+		}
+	}
+	for id, openings := range contents.GroupOpenings {
+		e.groupOpenings[id] = openings
+	}
+	e.store = store
+	example.WriteNote(fmt.Sprintf("Wallet of %s loaded with %d DIDs and %d credentials", name, len(contents.DIDs), len(contents.Credentials)))
+	return e, nil
+}
+
+// contents returns what a WalletStore keeps of the entity
+func (e *Entity) contents() WalletContents {
+	contents := WalletContents{Name: e.Name, DIDs: e.dids, GroupOpenings: e.groupOpenings}
+	for _, id := range e.credIDs {
+		contents.Credentials = append(contents.Credentials, StoredCredential{ID: id, Credential: e.creds[id]})
+	}
+	return contents
+}
+
+// save writes the wallet to the entity's store, if it has one
+func (e *Entity) save() error {
+	if e.store == nil {
+		return nil
+	}
+	if err := e.store.Save(e.contents()); err != nil {
+		return errors.Wrapf(err, "saving wallet of entity<%s>", e.Name)
+	}
+	return nil
+}
+
+// scrypt parameters of the wallet key, as recommended for interactive logins
+const (
+	walletFileVersion = 1
+	walletKDF         = "scrypt"
+	walletScryptN     = 1 << 15
+	walletScryptR     = 8
+	walletScryptP     = 1
+	walletSaltSize    = 16
+	walletKeySize     = 32
+)
+
+// walletFile is the layout of a FileWalletStore file. Everything but the key derivation parameters is encrypted.
+type walletFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// additionalData binds the ciphertext to the key derivation parameters stored next to it
+func (f walletFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%d:%d:%d", f.Version, f.KDF, f.N, f.R, f.P))
+}
+
+// FileWalletStore keeps a wallet in a file, encrypted with AES-256-GCM under a key derived from a passphrase with
+// scrypt. The key is derived once per store, from the salt of the file it loads or a new one; every save uses a
+// fresh nonce.
+type FileWalletStore struct {
+	file *encryptedFile
+}
+
+// NewFileWalletStore makes a store for the wallet file at path. Nothing is read or written until Load or Save.
+func NewFileWalletStore(path, passphrase string) (*FileWalletStore, error) {
+	file, err := newEncryptedFile(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWalletStore{file: file}, nil
+}
+
+// Load decrypts the wallet file. A missing file is an empty store; a wrong passphrase is ErrWalletLocked.
+func (s *FileWalletStore) Load() (*WalletContents, error) {
+	plaintext, err := s.file.read()
+	if err != nil || plaintext == nil {
+		return nil, err
+	}
+	var contents WalletContents
+	if err = json.Unmarshal(plaintext, &contents); err != nil {
+		return nil, fmt.Errorf("parsing wallet file<%s>: %w", s.file.path, err)
+	}
+	return &contents, nil
+}
+
+// Save encrypts the wallet and replaces the file with it. The file is written next to the old one and renamed
+// over it, so an interrupted save leaves the previous wallet in place.
+func (s *FileWalletStore) Save(contents WalletContents) error {
+	plaintext, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	return s.file.write(plaintext)
+}
+
+// encryptedFile is a file encrypted as a walletFile, shared by FileWalletStore and FileKeyManager
+type encryptedFile struct {
+	path       string
+	passphrase []byte
+
+	mux  sync.Mutex
+	salt []byte
+	aead cipher.AEAD
+}
+
+func newEncryptedFile(path, passphrase string) (*encryptedFile, error) {
+	if passphrase == "" {
+		return nil, errors.New("wallet passphrase cannot be empty")
+	}
+	return &encryptedFile{path: path, passphrase: []byte(passphrase)}, nil
+}
+
+// deriveKey sets up the cipher for salt, unless it already is
+func (f *encryptedFile) deriveKey(salt []byte) error {
+	if f.aead != nil && string(f.salt) == string(salt) {
+		return nil
+	}
+	key, err := scrypt.Key(f.passphrase, salt, walletScryptN, walletScryptR, walletScryptP, walletKeySize)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	f.salt, f.aead = salt, aead
+	return nil
+}
+
+// read decrypts the file, returning nil if it does not exist
+func (f *encryptedFile) read() ([]byte, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	dat, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var wf walletFile
+	if err = json.Unmarshal(dat, &wf); err != nil {
+		return nil, fmt.Errorf("parsing wallet file<%s>: %w", f.path, err)
+	}
+	if wf.Version != walletFileVersion || wf.KDF != walletKDF || wf.N != walletScryptN || wf.R != walletScryptR || wf.P != walletScryptP {
+		return nil, fmt.Errorf("wallet file<%s> has unsupported version %d or %s parameters", f.path, wf.Version, wf.KDF)
+	}
+	if err = f.deriveKey(wf.Salt); err != nil {
+		return nil, err
+	}
+	// Open panics on a nonce of the wrong size rather than failing
+	if len(wf.Nonce) != f.aead.NonceSize() {
+		return nil, errors.Wrapf(ErrWalletLocked, "wallet file<%s> has a nonce of %d bytes", f.path, len(wf.Nonce))
+	}
+	plaintext, err := f.aead.Open(nil, wf.Nonce, wf.Ciphertext, wf.additionalData())
+	if err != nil {
+		return nil, errors.Wrapf(ErrWalletLocked, "wallet file<%s>", f.path)
+	}
+	return plaintext, nil
+}
+
+// write encrypts plaintext and atomically replaces the file with it
+func (f *encryptedFile) write(plaintext []byte) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.aead == nil {
+		salt := make([]byte, walletSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		if err := f.deriveKey(salt); err != nil {
+			return err
+		}
+	}
+	wf := walletFile{
+		Version: walletFileVersion,
+		KDF:     walletKDF,
+		N:       walletScryptN,
+		R:       walletScryptR,
+		P:       walletScryptP,
+		Salt:    f.salt,
+		Nonce:   make([]byte, f.aead.NonceSize()),
+	}
+	if _, err := rand.Read(wf.Nonce); err != nil {
+		return err
+	}
+	wf.Ciphertext = f.aead.Seal(nil, wf.Nonce, plaintext, wf.additionalData())
+	dat, err := json.Marshal(wf)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(dat); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
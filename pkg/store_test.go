@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TBD54566975/ssi-sdk/did"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// openTestEntity opens the entity whose wallet and keys are kept in dir
+func openTestEntity(t *testing.T, dir, passphrase string) (*Entity, error) {
+	t.Helper()
+	store, err := NewFileWalletStore(filepath.Join(dir, "student.wallet"), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := NewFileKeyManager(filepath.Join(dir, "student.keys"), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return OpenEntity("Student", did.KeyMethod, store, WithKeyManager(keys))
+}
+
+func TestFileWalletStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	student, err := openTestEntity(t, dir, testPassphrase)
+	if err != nil {
+		t.Fatalf("opening new entity: %v", err)
+	}
+	signer, err := student.Signer()
+	if err != nil {
+		t.Fatalf("getting signer: %v", err)
+	}
+	if err = student.AddCredential("cred-1", "header.payload.signature"); err != nil {
+		t.Fatalf("adding credential: %v", err)
+	}
+	for _, name := range []string{"student.wallet", "student.keys"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected %s to be readable by its owner only, got %v", name, info.Mode().Perm())
+		}
+	}
+
+	reopened, err := openTestEntity(t, dir, testPassphrase)
+	if err != nil {
+		t.Fatalf("reopening entity: %v", err)
+	}
+	reopenedSigner, err := reopened.Signer()
+	if err != nil {
+		t.Fatalf("getting signer: %v", err)
+	}
+	if reopenedSigner.ID != signer.ID || reopenedSigner.KID != signer.KID || reopenedSigner.X != signer.X {
+		t.Fatalf("expected the DID and key to be restored, got %s%s", reopenedSigner.ID, reopenedSigner.KID)
+	}
+	if creds := reopened.GetCredentials(); len(creds) != 1 || creds[0] != "header.payload.signature" {
+		t.Fatalf("expected the credential to be restored, got %v", creds)
+	}
+}
+
+func TestFileWalletStoreLocked(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := openTestEntity(t, dir, testPassphrase); err != nil {
+		t.Fatalf("opening new entity: %v", err)
+	}
+	if _, err := openTestEntity(t, dir, "wrong passphrase"); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("expected %v, got %v", ErrWalletLocked, err)
+	}
+	if _, err := NewFileWalletStore(filepath.Join(dir, "student.wallet"), ""); err == nil {
+		t.Fatal("expected an empty passphrase to be rejected")
+	}
+
+	path := filepath.Join(dir, "student.wallet")
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading wallet file: %v", err)
+	}
+	tests := []struct {
+		name    string
+		tamper  func(wf *walletFile)
+		wantErr error
+	}{
+		{name: "ciphertext changed", tamper: func(wf *walletFile) { wf.Ciphertext[0] ^= 1 }, wantErr: ErrWalletLocked},
+		{name: "nonce changed", tamper: func(wf *walletFile) { wf.Nonce[0] ^= 1 }, wantErr: ErrWalletLocked},
+		{name: "nonce truncated", tamper: func(wf *walletFile) { wf.Nonce = wf.Nonce[:4] }, wantErr: ErrWalletLocked},
+		{name: "salt changed", tamper: func(wf *walletFile) { wf.Salt[0] ^= 1 }, wantErr: ErrWalletLocked},
+		{name: "weaker key derivation", tamper: func(wf *walletFile) { wf.N = 1 << 10 }},
+		{name: "other version", tamper: func(wf *walletFile) { wf.Version = walletFileVersion + 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wf walletFile
+			if err := json.Unmarshal(dat, &wf); err != nil {
+				t.Fatalf("parsing wallet file: %v", err)
+			}
+			tt.tamper(&wf)
+			tampered, err := json.Marshal(wf)
+			if err != nil {
+				t.Fatalf("encoding wallet file: %v", err)
+			}
+			tamperedPath := filepath.Join(t.TempDir(), "student.wallet")
+			if err = os.WriteFile(tamperedPath, tampered, 0o600); err != nil {
+				t.Fatalf("writing wallet file: %v", err)
+			}
+			store, err := NewFileWalletStore(tamperedPath, testPassphrase)
+			if err != nil {
+				t.Fatalf("making store: %v", err)
+			}
+			contents, err := store.Load()
+			if err == nil {
+				t.Fatalf("expected the tampered wallet not to load, got %d DIDs", len(contents.DIDs))
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFileWalletStoreMissing(t *testing.T) {
+	store, err := NewFileWalletStore(filepath.Join(t.TempDir(), "missing.wallet"), testPassphrase)
+	if err != nil {
+		t.Fatalf("making store: %v", err)
+	}
+	contents, err := store.Load()
+	if err != nil || contents != nil {
+		t.Fatalf("expected a missing wallet to load as empty, got %v, %v", contents, err)
+	}
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// ErrSubmissionMismatch is returned when a presentation_submission does not satisfy the presentation definition
+// the verifier sent
+var ErrSubmissionMismatch = errors.New("presentation submission does not satisfy the presentation definition")
+
+// presentationSubmissionOf returns the presentation_submission carried in a VP
+func presentationSubmissionOf(vp *credential.VerifiablePresentation) (*exchange.PresentationSubmission, error) {
+	if vp.PresentationSubmission == nil {
+		return nil, errors.Wrap(ErrSubmissionMismatch, "VP has no presentation_submission")
+	}
+	dat, err := json.Marshal(vp.PresentationSubmission)
+	if err != nil {
+		return nil, err
+	}
+	var submission exchange.PresentationSubmission
+	if err = json.Unmarshal(dat, &submission); err != nil {
+		return nil, errors.Wrapf(ErrSubmissionMismatch, "malformed presentation_submission: %s", err)
+	}
+	return &submission, nil
+}
+
+// descriptorFormat is the claim format an input descriptor accepts: its own, or else the definition's
+func descriptorFormat(def exchange.PresentationDefinition, desc exchange.InputDescriptor) *exchange.ClaimFormat {
+	if desc.Format != nil {
+		return desc.Format
+	}
+	return def.Format
+}
+
+// formatAccepts reports whether a claim format lists format, e.g. jwt_vc, and alg among the algorithms or proof
+// types listed for it. No format restriction accepts anything, and a format listing no algorithms accepts any.
+func formatAccepts(claimFormat *exchange.ClaimFormat, format, alg string) bool {
+	if claimFormat == nil {
+		return true
+	}
+	formats, err := util.ToJSONMap(claimFormat)
+	if err != nil {
+		return false
+	}
+	entry, ok := formats[format]
+	if !ok {
+		return false
+	}
+	constraints, _ := entry.(map[string]any)
+	for _, key := range []string{"alg", "proof_type"} {
+		allowed, ok := constraints[key].([]any)
+		if !ok || len(allowed) == 0 {
+			continue
+		}
+		for _, a := range allowed {
+			if a == alg {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// checkPresentationSubmission evaluates a VP's presentation_submission against the definition the verifier sent:
+// the answered input descriptors must meet the submission requirements (or be all of them if there are none),
+// each descriptor_map entry must point at a presented credential in an accepted format, and that credential must
+// satisfy the descriptor's fields and filters
+func checkPresentationSubmission(def exchange.PresentationDefinition, vp *credential.VerifiablePresentation, creds []VerifiedCredential) error {
+	submission, err := presentationSubmissionOf(vp)
+	if err != nil {
+		return err
+	}
+	if submission.DefinitionID != def.ID {
+		return errors.Wrapf(ErrSubmissionMismatch, "submission answers definition<%s>, expected<%s>", submission.DefinitionID, def.ID)
+	}
+	vpJSON, err := util.ToJSONMap(vp)
+	if err != nil {
+		return err
+	}
+	descriptors := make(map[string]int, len(def.InputDescriptors))
+	for i, desc := range def.InputDescriptors {
+		descriptors[desc.ID] = i
+	}
+	answered := make(map[int]bool)
+	for _, sd := range submission.DescriptorMap {
+		index, ok := descriptors[sd.ID]
+		if !ok {
+			return errors.Wrapf(ErrSubmissionMismatch, "descriptor_map entry<%s> answers no input descriptor", sd.ID)
+		}
+		desc := def.InputDescriptors[index]
+		if sd.PathNested != nil {
+			return errors.Wrapf(ErrSubmissionMismatch, "descriptor_map entry<%s>: path_nested is not supported", sd.ID)
+		}
+
+		values, found := lookupPath(vpJSON, sd.Path)
+		if !found || len(values) != 1 {
+			return errors.Wrapf(ErrSubmissionMismatch, "descriptor_map entry<%s> path<%s> does not select one credential", sd.ID, sd.Path)
+		}
+		cred, err := presentedCredential(values[0], creds)
+		if err != nil {
+			return err
+		}
+		if cred == nil {
+			return errors.Wrapf(ErrSubmissionMismatch, "descriptor_map entry<%s> path<%s> does not select a presented credential", sd.ID, sd.Path)
+		}
+		if sd.Format != cred.Format || !formatAccepts(descriptorFormat(def, desc), cred.Format, cred.Alg) {
+			return errors.Wrapf(ErrSubmissionMismatch, "descriptor_map entry<%s> presents a %s credential signed with %s, which input descriptor<%s> does not accept",
+				sd.ID, sd.Format, cred.Alg, desc.ID)
+		}
+		claims, err := cred.claims()
+		if err != nil {
+			return err
+		}
+		if field := unmatchedField(desc, claims); field != nil {
+			return errors.Wrapf(ErrSubmissionMismatch, "credential at %s does not satisfy field<%s> %v of input descriptor<%s>",
+				sd.Path, field.ID, field.Path, desc.ID)
+		}
+		answered[index] = true
+	}
+
+	if err = checkSubmissionRequirements(def, answered); err != nil {
+		return errors.Wrap(ErrSubmissionMismatch, err.Error())
+	}
+	return nil
+}
+
+// presentedCredential returns the verified credential a descriptor_map path selected, or nil: a JWT VC is matched
+// by its JWT, and a JSON-LD credential, which has no JWT, by its id
+func presentedCredential(selected any, creds []VerifiedCredential) (*SubmissionCredential, error) {
+	for _, c := range creds {
+		var (
+			cred SubmissionCredential
+			err  error
+		)
+		switch value := selected.(type) {
+		case string:
+			if c.JWT == "" || c.JWT != value {
+				continue
+			}
+			cred, err = JWTCredential(c.JWT)
+		case map[string]any:
+			if c.JWT != "" || c.Credential.ID == "" || value["id"] != c.Credential.ID {
+				continue
+			}
+			dat, marshalErr := json.Marshal(c.Credential)
+			if marshalErr != nil {
+				return nil, marshalErr
+			}
+			cred, err = LDCredential(string(dat))
+		default:
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &cred, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultCredentialContext is the JSON-LD context used when a template does not set one
+var DefaultCredentialContext = []string{"https://www.w3.org/2018/credentials/v1",
+	"https://www.w3.org/2018/credentials/examples/v1"}
+
+// CredentialTemplate describes a credential to issue without hard-coding it in Go.
+// It can be built in code or loaded from a JSON or YAML file with LoadCredentialTemplate.
+// The recipient DID is supplied at issuance time and set as credentialSubject.id.
+type CredentialTemplate struct {
+	// ID is the credential id; a urn:uuid is generated when empty
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Context defaults to DefaultCredentialContext; YAML files quote the "@context" key, as @ cannot start a plain one
+	Context []string `json:"@context,omitempty" yaml:"@context,omitempty"`
+	// Type must contain VerifiableCredential; it is added when missing
+	Type []string `json:"type" yaml:"type"`
+	// Subject holds the claims about the recipient
+	Subject map[string]any `json:"credentialSubject" yaml:"credentialSubject"`
+	// OmitSubjectID leaves credentialSubject.id unset, for credentials that reference the recipient inside a claim
+	OmitSubjectID bool `json:"omitSubjectId,omitempty" yaml:"omitSubjectId,omitempty"`
+	// ValidFor is how long the credential is valid after issuance (e.g. "8760h"); empty means no expiry
+	ValidFor string `json:"validFor,omitempty" yaml:"validFor,omitempty"`
+}
+
+// IsValid checks the template can be turned into a credential
+func (t *CredentialTemplate) IsValid() error {
+	if len(t.Type) == 0 {
+		return fmt.Errorf("credential template must have at least one type")
+	}
+	if len(t.Subject) == 0 {
+		return fmt.Errorf("credential template must have subject claims")
+	}
+	if _, err := t.validity(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validity parses ValidFor; zero means the credential does not expire
+func (t *CredentialTemplate) validity() (time.Duration, error) {
+	if t.ValidFor == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.ValidFor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid validFor<%s>: %w", t.ValidFor, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("validFor<%s> must be positive", t.ValidFor)
+	}
+	return d, nil
+}
+
+// contexts returns the template contexts, falling back to the default
+func (t *CredentialTemplate) contexts() []string {
+	if len(t.Context) == 0 {
+		return DefaultCredentialContext
+	}
+	return t.Context
+}
+
+// types returns the template types, making sure VerifiableCredential comes first
+func (t *CredentialTemplate) types() []string {
+	types := []string{"VerifiableCredential"}
+	for _, typ := range t.Type {
+		if typ != "VerifiableCredential" {
+			types = append(types, typ)
+		}
+	}
+	return types
+}
+
+// LoadCredentialTemplate reads a credential template from a .json, .yaml or .yml file
+func LoadCredentialTemplate(path string) (*CredentialTemplate, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t CredentialTemplate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(dat, &t)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(dat, &t)
+	default:
+		return nil, fmt.Errorf("unsupported template file<%s>; expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing template<%s>: %w", path, err)
+	}
+	if err = t.IsValid(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
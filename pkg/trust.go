@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/util"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// AnyCredentialType in a TrustedIssuer's types lets the issuer issue credentials of any type
+const AnyCredentialType = "*"
+
+// ErrIssuerUntrusted is returned for a credential whose issuer is not in the verifier's trusted issuer registry,
+// or which is of a type its issuer is not trusted for
+var ErrIssuerUntrusted = errors.New("credential issuer is not trusted")
+
+// TrustedIssuer is an issuer the verifier accepts credentials from, and the credential types it may issue.
+// VerifiableCredential is implied and does not need to be listed.
+type TrustedIssuer struct {
+	DID   string   `json:"did" yaml:"did"`
+	Name  string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Types []string `json:"types" yaml:"types"`
+}
+
+// trustedIssuersFile is the layout of a trusted issuer registry file
+type trustedIssuersFile struct {
+	Issuers []TrustedIssuer `json:"issuers" yaml:"issuers"`
+}
+
+// TrustedIssuerRegistry is the set of issuers a verifier trusts, keyed by DID
+type TrustedIssuerRegistry struct {
+	mux     sync.RWMutex
+	issuers map[string]TrustedIssuer
+}
+
+// NewTrustedIssuerRegistry creates a registry trusting the given issuers
+func NewTrustedIssuerRegistry(issuers ...TrustedIssuer) (*TrustedIssuerRegistry, error) {
+	t := TrustedIssuerRegistry{issuers: make(map[string]TrustedIssuer)}
+	for _, issuer := range issuers {
+		if err := t.Add(issuer); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// LoadTrustedIssuers reads a registry from a .json, .yaml or .yml file listing issuers under "issuers"
+func LoadTrustedIssuers(path string) (*TrustedIssuerRegistry, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f trustedIssuersFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(dat, &f)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(dat, &f)
+	default:
+		return nil, fmt.Errorf("unsupported trusted issuers file<%s>; expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing trusted issuers<%s>: %w", path, err)
+	}
+	return NewTrustedIssuerRegistry(f.Issuers...)
+}
+
+// Add trusts an issuer, replacing what was trusted for its DID before
+func (t *TrustedIssuerRegistry) Add(issuer TrustedIssuer) error {
+	if issuer.DID == "" {
+		return errors.New("trusted issuer needs a DID")
+	}
+	if len(issuer.Types) == 0 {
+		return fmt.Errorf("trusted issuer<%s> needs at least one credential type", issuer.DID)
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.issuers[issuer.DID] = issuer
+	return nil
+}
+
+// Remove stops trusting the issuer with the given DID
+func (t *TrustedIssuerRegistry) Remove(issuerDID string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	delete(t.issuers, issuerDID)
+}
+
+// Issuer returns what is trusted for an issuer DID
+func (t *TrustedIssuerRegistry) Issuer(issuerDID string) (TrustedIssuer, bool) {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	issuer, ok := t.issuers[issuerDID]
+	return issuer, ok
+}
+
+// CheckCredential fails with ErrIssuerUntrusted unless the credential's issuer is trusted for every type of the
+// credential
+func (t *TrustedIssuerRegistry) CheckCredential(cred *credential.VerifiableCredential) error {
+	issuerDID, _ := cred.Issuer.(string)
+	issuer, ok := t.Issuer(issuerDID)
+	if !ok {
+		return errors.Wrapf(ErrIssuerUntrusted, "credential<%s> issued by unknown issuer<%s>", cred.ID, issuerDID)
+	}
+	if util.Contains(AnyCredentialType, issuer.Types) {
+		return nil
+	}
+	types, err := util.InterfaceToStrings(cred.Type)
+	if err != nil {
+		return errors.Wrapf(err, "credential<%s> types", cred.ID)
+	}
+	for _, credType := range types {
+		if credType == credential.VerifiableCredentialType {
+			continue
+		}
+		if !util.Contains(credType, issuer.Types) {
+			return errors.Wrapf(ErrIssuerUntrusted, "issuer<%s> is not trusted to issue credential<%s> of type<%s>",
+				issuerDID, cred.ID, credType)
+		}
+	}
+	return nil
+}
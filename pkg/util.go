@@ -1,19 +1,38 @@
 package pkg
 
 import (
-	gocrypto "crypto"
+	"context"
 	"fmt"
+	"github.com/TBD54566975/ssi-sdk/credential"
 	"github.com/TBD54566975/ssi-sdk/credential/exchange"
 	"github.com/TBD54566975/ssi-sdk/crypto"
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+	"github.com/TBD54566975/ssi-sdk/did/peer"
 	"github.com/TBD54566975/ssi-sdk/example"
 	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"strings"
 )
 
 type Entity struct {
 	wallet *example.SimpleWallet
-	Name   string
+	// keys holds the private keys of the entity's DIDs, which never leave it
+	keys KeyManager
+	// dids holds the entity's DIDs in the order they were made, with the ids their keys have in keys
+	dids []StoredDID
+	// credIDs keeps the order credentials were added in; the wallet cannot list its credentials
+	credIDs []string
+	creds   map[string]string
+	// groupOpenings holds the openings of the group commitment VCs in the wallet, by credential id
+	groupOpenings map[string][]GroupOpening
+	// statusRegistry is only set for issuers, see InitStatusRegistry
+	statusRegistry *StatusRegistry
+	// store keeps the wallet between runs; nil for entities made with NewEntity
+	store WalletStore
+	Name  string
 }
 
 // Holds the assigned DIDs
@@ -21,87 +40,260 @@ func (e *Entity) GetWallet() *example.SimpleWallet {
 	return e.wallet
 }
 
-func NewEntity(name string, didMethod did.Method) (*Entity, error) {
-	e := Entity{
-		wallet: example.NewSimpleWallet(),
-		Name:   name,
+// AddCredential stores a JWT credential, or a JSON-LD credential from IssueDataIntegrity, in the wallet and keeps
+// it available to GetCredentials. A credential with the id of one already held replaces it, as when it is reissued.
+func (e *Entity) AddCredential(credID, cred string) error {
+	if _, held := e.creds[credID]; !held {
+		if err := e.wallet.AddCredentialJWT(credID, cred); err != nil {
+			return err
+		}
+		e.credIDs = append(e.credIDs, credID)
 	}
-	if err := e.wallet.Init(didMethod); err != nil {
-		return nil, err
+	e.creds[credID] = cred
+	return e.save()
+}
+
+// GetCredentials returns the credentials added with AddCredential, in the order they were added
+func (e *Entity) GetCredentials() []string {
+	creds := make([]string, 0, len(e.credIDs))
+	for _, id := range e.credIDs {
+		creds = append(creds, e.creds[id])
 	}
-	return &e, nil
+	return creds
 }
 
-// MakePresentationRequest Builds a presentation request (PR) sent by the verifier
-func MakePresentationRequest(key gocrypto.PrivateKey, keyID string, presentationData exchange.PresentationDefinition, requesterID, audienceID string) (pr []byte, signer *jwx.Signer, err error) {
-	example.WriteNote("Presentation Request (JWT) is created")
+// Signer returns a signer for the entity's first DID and its current key, the last one RotateKey made. It signs
+// through the entity's KeyManager, so its JWK only carries the public key.
+func (e *Entity) Signer() (*jwx.Signer, error) {
+	if len(e.dids) == 0 {
+		return nil, fmt.Errorf("entity<%s> has no DID", e.Name)
+	}
+	d := e.dids[0]
+	if len(d.Keys) == 0 {
+		return nil, fmt.Errorf("entity<%s> has no key for DID<%s>", e.Name, d.ID)
+	}
+	current := d.Keys[len(d.Keys)-1]
+	return managedJWXSigner(e.keys, d.ID, current.ID, current.KeyID)
+}
 
-	// Signer uses a private key
-	signer, err = jwx.NewJWXSigner(requesterID, keyID, key)
+// RespondToPresentationRequest answers a presentation request from the wallet: the request's definition is
+// evaluated against every credential the entity holds, the smallest set satisfying it is chosen and the
+// submission is signed with the entity's key. requestVerifier checks the requester's signature on the request.
+// If some input descriptors cannot be met, the error says which and why (ErrUnmetInputDescriptor).
+func (e *Entity) RespondToPresentationRequest(presentationRequestJWT string, requestVerifier jwx.Verifier) ([]byte, error) {
+	signer, err := e.Signer()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-
-	// Builds a presentation request
-	// Requires a signer, the presentation data, and a target which is the Audience Key
-	requestJWTBytes, err := exchange.BuildJWTPresentationRequest(*signer, presentationData, []string{audienceID})
+	creds, err := e.heldCredentials(exchange.JWTVC.String())
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	return BuildSubmission(presentationRequestJWT, requestVerifier, *signer, creds...)
+}
+
+// heldCredentials describes the credentials in the wallet that are in the given format: JSON-LD credentials are
+// ldp_vc and anything else is taken to be a JWT VC
+func (e *Entity) heldCredentials(format string) ([]SubmissionCredential, error) {
+	var creds []SubmissionCredential
+	for _, cred := range e.GetCredentials() {
+		credFormat := exchange.JWTVC.String()
+		if strings.HasPrefix(strings.TrimSpace(cred), "{") {
+			credFormat = exchange.LDPVC.String()
+		}
+		if credFormat != format {
+			continue
+		}
+		describe := JWTCredential
+		if credFormat == exchange.LDPVC.String() {
+			describe = LDCredential
+		}
+		c, err := describe(cred)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
 	}
+	return creds, nil
+}
+
+// InitStatusRegistry sets up the revocation and suspension lists of an issuing entity, published under baseURL
+func (e *Entity) InitStatusRegistry(signer jwx.Signer, baseURL string) *StatusRegistry {
+	e.statusRegistry = NewStatusRegistry(signer, baseURL)
+	return e.statusRegistry
+}
+
+// GetStatusRegistry returns the entity's status lists, or nil if InitStatusRegistry was not called
+func (e *Entity) GetStatusRegistry() *StatusRegistry {
+	return e.statusRegistry
+}
+
+// EntityOption configures an entity made with NewEntity or OpenEntity
+type EntityOption func(*entityOptions)
 
-	return requestJWTBytes, signer, err
+type entityOptions struct {
+	keys    KeyManager
+	keyType crypto.KeyType
+	webHost *DIDWebHost
 }
 
-// BuildPresentationSubmission builds a submission using...
-// https://github.com/TBD54566975/ssi-sdk/blob/d279ca2779361091a70b8aa3c685a388067409a9/credential/exchange/submission.go#L126
-func BuildPresentationSubmission(presentationRequestJWT string, verifier jwx.Verifier, signer jwx.Signer, vc string) ([]byte, error) {
-	presentationClaim := exchange.PresentationClaim{
-		Token:                         &vc,
-		JWTFormat:                     exchange.JWTVC.Ptr(),
-		SignatureAlgorithmOrProofType: crypto.Ed25519.String(),
+// WithKeyManager keeps the entity's private keys in km instead of a new MemoryKeyManager
+func WithKeyManager(km KeyManager) EntityOption {
+	return func(o *entityOptions) {
+		o.keys = km
 	}
+}
 
-	_, parsedPresentationRequest, err := verifier.VerifyAndParse(presentationRequestJWT)
-	if err != nil {
-		return nil, err
+// WithKeyType makes the entity's DID key of type kt, one of SupportedKeyTypes, instead of Ed25519.
+// Everything the entity signs, and the alg of its credentials in presentations, follows from the key type.
+func WithKeyType(kt crypto.KeyType) EntityOption {
+	return func(o *entityOptions) {
+		o.keyType = kt
 	}
+}
 
-	def, ok := parsedPresentationRequest.Get(exchange.PresentationDefinitionKey)
-	if !ok {
-		return nil, fmt.Errorf("presentation definition key<%s> not found in token", exchange.PresentationDefinitionKey)
+// WithDIDWebHost serves the DID document of the entity's did:web DID on host; NewEntity needs it for did:web
+func WithDIDWebHost(host *DIDWebHost) EntityOption {
+	return func(o *entityOptions) {
+		o.webHost = host
 	}
+}
 
-	dat, err := json.Marshal(def)
-	if err != nil {
+// NewEntity makes an entity with a new DID of didMethod, whose key is made by its KeyManager. A did:web DID is
+// DID(name) of the entity's DIDWebHost, which serves its document right away.
+func NewEntity(name string, didMethod did.Method, opts ...EntityOption) (*Entity, error) {
+	e, o := newEntity(name, opts...)
+	if err := e.createDID(didMethod, o); err != nil {
 		return nil, err
 	}
-	var pd exchange.PresentationDefinition
-	if err = json.Unmarshal(dat, &pd); err != nil {
-		return nil, err
+	return e, nil
+}
+
+// newEntity makes an entity without DIDs, returning it with the options its DIDs are to be made with
+func newEntity(name string, opts ...EntityOption) (*Entity, entityOptions) {
+	o := entityOptions{keyType: crypto.Ed25519}
+	for _, opt := range opts {
+		opt(&o)
 	}
+	if o.keys == nil {
+		o.keys = NewMemoryKeyManager()
+	}
+	return &Entity{
+		wallet:        example.NewSimpleWallet(),
+		keys:          o.keys,
+		creds:         make(map[string]string),
+		groupOpenings: make(map[string][]GroupOpening),
+		Name:          name,
+	}, o
+}
 
-	submissionBytes, err := exchange.BuildPresentationSubmission(signer, parsedPresentationRequest.Issuer(), pd, []exchange.PresentationClaim{presentationClaim}, exchange.JWTVPTarget)
+// createDID makes a did:peer, did:key or did:web DID for a new key of the entity's KeyManager, of the type in o
+func (e *Entity) createDID(didMethod did.Method, o entityOptions) error {
+	kt := o.keyType
+	switch didMethod {
+	case did.PeerMethod, did.KeyMethod:
+	case did.WebMethod:
+		if o.webHost == nil {
+			return fmt.Errorf("entity<%s> needs a DIDWebHost for a did:web DID", e.Name)
+		}
+		if o.webHost.hosts(o.webHost.DID(e.Name)) {
+			return fmt.Errorf("DID<%s> is already hosted", o.webHost.DID(e.Name))
+		}
+	default:
+		return fmt.Errorf("unsupported did method<%s>", didMethod)
+	}
+	if !isSupportedKeyType(kt) {
+		return fmt.Errorf("unsupported key type<%s>, expected one of %v", kt, SupportedKeyTypes())
+	}
+	keyID, err := e.keys.CreateKey(kt)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	pubKey, err := e.keys.PublicKey(keyID)
+	if err != nil {
+		return err
+	}
+	if pubKey, err = didPublicKey(kt, pubKey); err != nil {
+		return err
 	}
 
-	return submissionBytes, nil
-}
-
-// BuildCombinedPresentationSubmission combines 2 VCs for submission to the presentation request
-func BuildCombinedPresentationSubmission(presentationRequestJWT string, verifier jwx.Verifier, signer jwx.Signer, vc string, vc2 string) ([]byte, error) {
-	presentationClaim := exchange.PresentationClaim{
-		Token:                         &vc,
-		JWTFormat:                     exchange.JWTVC.Ptr(),
-		SignatureAlgorithmOrProofType: crypto.Ed25519.String(),
+	var didStr, kid string
+	switch didMethod {
+	case did.PeerMethod:
+		didPeer, err := peer.Method0{}.Generate(kt, pubKey)
+		if err != nil {
+			return err
+		}
+		didStr = didPeer.String()
+		resolvedPeer, err := peer.Resolver{}.Resolve(context.Background(), didStr)
+		if err != nil {
+			return err
+		}
+		kid = resolvedPeer.Document.VerificationMethod[0].ID
+	case did.KeyMethod:
+		pubKeyBytes, err := crypto.PubKeyToBytes(pubKey)
+		if err != nil {
+			return err
+		}
+		didKey, err := key.CreateDIDKey(kt, pubKeyBytes)
+		if err != nil {
+			return err
+		}
+		didStr = didKey.String()
+		expanded, err := didKey.Expand()
+		if err != nil {
+			return err
+		}
+		kid = expanded.VerificationMethod[0].ID
+	case did.WebMethod:
+		// the document is published below, with the keys named like those RotateKey adds
+		didStr = o.webHost.DID(e.Name)
+		kid = "#key-1"
 	}
 
-	presentationClaim2 := exchange.PresentationClaim{
-		Token:                         &vc2,
-		JWTFormat:                     exchange.JWTVC.Ptr(),
-		SignatureAlgorithmOrProofType: crypto.Ed25519.String(),
+	// a key the entity cannot sign JWTs with is of no use
+	if _, err = managedJWXSigner(e.keys, didStr, kid, keyID); err != nil {
+		return fmt.Errorf("%s keys cannot sign JWTs in this build: %w", kt, err)
+	}
+	example.WriteNote(fmt.Sprintf("DID for holder is: %s", didStr))
+	if err = e.wallet.AddDID(didStr); err != nil {
+		return err
 	}
+	example.WriteNote("DID stored in wallet")
+	e.dids = append(e.dids, StoredDID{ID: didStr, Keys: []StoredKey{{ID: kid, KeyID: keyID}}})
+	example.WriteNote("Private Key stored with the key manager")
+	if didMethod == did.WebMethod {
+		return e.PublishDIDDocument(o.webHost)
+	}
+	return nil
+}
+
+// MakePresentationRequest Builds a presentation request (PR) sent by the verifier, signer.ID, to audienceID
+// The request carries the challenge's nonce and expires with it; the VP answering it has to echo the nonce.
+func MakePresentationRequest(signer jwx.Signer, presentationData exchange.PresentationDefinition, audienceID string, challenge PresentationChallenge) ([]byte, error) {
+	example.WriteNote("Presentation Request (JWT) is created")
+
+	// Builds a presentation request
+	// Requires a signer, the presentation data, a target which is the Audience Key and the challenge
+	return signer.SignWithDefaults(map[string]any{
+		jwt.JwtIDKey:                       uuid.NewString(),
+		jwt.AudienceKey:                    []string{audienceID},
+		jwt.ExpirationKey:                  challenge.ExpiresAt.Unix(),
+		credential.NonceProperty:           challenge.Nonce,
+		exchange.PresentationDefinitionKey: presentationData,
+	})
+}
+
+// presentationRequest is what the holder reads from a verified presentation request
+type presentationRequest struct {
+	definition exchange.PresentationDefinition
+	requester  string
+	nonce      string
+}
 
+// parsePresentationRequest verifies the presentation request JWT, rejecting expired requests, and returns the
+// presentation definition it carries along with the DID of the requester and the nonce to echo
+func parsePresentationRequest(presentationRequestJWT string, verifier jwx.Verifier) (*presentationRequest, error) {
 	_, parsedPresentationRequest, err := verifier.VerifyAndParse(presentationRequestJWT)
 	if err != nil {
 		return nil, err
@@ -111,101 +303,90 @@ func BuildCombinedPresentationSubmission(presentationRequestJWT string, verifier
 	if !ok {
 		return nil, fmt.Errorf("presentation definition key<%s> not found in token", exchange.PresentationDefinitionKey)
 	}
+	nonce, _ := parsedPresentationRequest.Get(credential.NonceProperty)
+	nonceStr, ok := nonce.(string)
+	if !ok || nonceStr == "" {
+		return nil, fmt.Errorf("presentation request has no %s", credential.NonceProperty)
+	}
 
 	dat, err := json.Marshal(def)
 	if err != nil {
 		return nil, err
 	}
-	var pd exchange.PresentationDefinition
-	if err = json.Unmarshal(dat, &pd); err != nil {
-		return nil, err
-	}
-
-	submissionBytes, err := exchange.BuildPresentationSubmission(signer, parsedPresentationRequest.Issuer(), pd, []exchange.PresentationClaim{presentationClaim, presentationClaim2}, exchange.JWTVPTarget)
-	if err != nil {
+	req := presentationRequest{requester: parsedPresentationRequest.Issuer(), nonce: nonceStr}
+	if err = json.Unmarshal(dat, &req.definition); err != nil {
 		return nil, err
 	}
-
-	return submissionBytes, nil
+	return &req, nil
 }
 
 // MakePresentationData Makes a presentation definition. These are eventually transported via Presentation Request.
 // Used to request the VC by verifier. It expects fields like issuer and vc.issuer to be the data
-// Used in Case2 - (single VC presentation)
-func MakePresentationData(id, inputID, trustedIssuer string) (exchange.PresentationDefinition, error) {
+// Used in Case1 - (single VC presentation)
+// With algs only jwt_vc credentials signed with one of them are accepted, e.g. the alg of the trusted issuer's key.
+func MakePresentationData(id, inputID, trustedIssuer string, algs ...crypto.SignatureAlgorithm) (exchange.PresentationDefinition, error) {
 	// Input Descriptors: Describe the information the verifier requires of the holder
 	// https://identity.foundation/presentation-exchange/#input-descriptor
 	// Required fields: ID and Input Descriptors
-	def := exchange.PresentationDefinition{
-		ID: id,
-		InputDescriptors: []exchange.InputDescriptor{
-			{
-				ID: inputID,
-				Constraints: &exchange.Constraints{
-					Fields: []exchange.Field{
-						{
-							Path:    []string{"$.iss", "$.vc.issuer", "$.issuer"},
-							ID:      "issuer-input-descriptor",
-							Purpose: "need to check the issuer",
-							Filter: &exchange.Filter{
-								Type:    "string",
-								Pattern: trustedIssuer,
-							},
-						},
-					},
-				},
-			},
-		},
+	def, err := withAlgs(NewPresentationDefinition(id), algs).
+		Descriptor(NewInputDescriptor(inputID).
+			Field(issuerField("issuer-input-descriptor", "need to check the issuer", trustedIssuer))).
+		Build()
+	if err != nil {
+		return def, err
 	}
 	example.WriteNote("Presentation Definition is formed. Asks for the issuer and the data from the issuer")
-	err := def.IsValid()
+	err = def.IsValid()
 	return def, err
 }
 
-// MakeCombinedPresentationData requests the VC by verifier. It expects fields like issuer and vc.issuer to be in VC1 and identityReference in VC2
-// Used in Case1 - ( Combined VC presentation)
-func MakeCombinedPresentationData(id, inputID, inputID2, trustedIssuer string) (exchange.PresentationDefinition, error) {
+// MakeCombinedPresentationData requests the VC by verifier. It expects fields like issuer and vc.issuer and the
+// alumniOf claim of the identity VC to be in VC1
+// and a membership VC from the same issuer whose IdentityReference holds the requested role in VC2
+// Used in Case2 - ( Combined VC presentation)
+// With algs only jwt_vc credentials signed with one of them are accepted, as in MakePresentationData.
+func MakeCombinedPresentationData(id, inputID, inputID2, trustedIssuer, role string, algs ...crypto.SignatureAlgorithm) (exchange.PresentationDefinition, error) {
 	// Input Descriptors: Describe the information the verifier requires of the holder
 	// https://identity.foundation/presentation-exchange/#input-descriptor
 	// Required fields: ID and Input Descriptors
-	def := exchange.PresentationDefinition{
-		ID: id,
-		InputDescriptors: []exchange.InputDescriptor{
-			{
-				ID: inputID,
-				Constraints: &exchange.Constraints{
-					Fields: []exchange.Field{
-						{
-							Path:    []string{"$.iss", "$.vc.issuer", "$.issuer"},
-							ID:      "issuer-input-descriptor",
-							Purpose: "need to check the issuer",
-							Filter: &exchange.Filter{
-								Type:    "string",
-								Pattern: trustedIssuer,
-							},
-						},
-					},
-				},
-			},
-			{
-				ID: inputID2,
-				Constraints: &exchange.Constraints{
-					Fields: []exchange.Field{
-						{
-							Path:    []string{"$.vc.credentialSubject.IdentityReference"},
-							ID:      "issuer-input-membership-descriptor",
-							Purpose: "need to check the membership",
-							Filter: &exchange.Filter{
-								Type:    "string",
-								Pattern: trustedIssuer,
-							},
-						},
-					},
-				},
-			},
-		},
+	def, err := withAlgs(NewPresentationDefinition(id), algs).
+		Descriptor(NewInputDescriptor(inputID).
+			Field(issuerField("issuer-input-descriptor", "need to check the issuer", trustedIssuer)).
+			Field(NewField(alumniOfPath).
+				ID("identity-input-descriptor").
+				Purpose("need the identity VC the membership is linked to"))).
+		Descriptor(NewInputDescriptor(inputID2).
+			Field(issuerField("issuer-input-membership-descriptor", "need to check the issuer of the membership", trustedIssuer)).
+			Field(roleField("role-input-membership-descriptor", role))).
+		Build()
+	if err != nil {
+		return def, err
 	}
 	example.WriteNote("Presentation Definition is formed. Asks for the issuer and the data from the issuer")
-	err := def.IsValid()
+	err = def.IsValid()
 	return def, err
 }
+
+// withAlgs restricts a definition to jwt_vc credentials signed with one of algs, if any are given
+func withAlgs(b *DefinitionBuilder, algs []crypto.SignatureAlgorithm) *DefinitionBuilder {
+	if len(algs) == 0 {
+		return b
+	}
+	return b.Format(JWTVCFormat(algs...))
+}
+
+// JSONPaths of the demo credentials the definitions above look at
+const (
+	alumniOfPath = "$.vc.credentialSubject.alumniOf.name"
+	rolesPath    = "$.vc.credentialSubject.IdentityReference.roles[*].value"
+)
+
+// issuerField requires the credential to be issued by exactly the trusted issuer
+func issuerField(id, purpose, trustedIssuer string) *FieldBuilder {
+	return NewField("$.iss", "$.vc.issuer", "$.issuer").ID(id).Purpose(purpose).Equals(trustedIssuer)
+}
+
+// roleField requires a membership VC whose IdentityReference holds role
+func roleField(id, role string) *FieldBuilder {
+	return NewField(rolesPath).ID(id).Purpose("need to check the membership").Equals(role)
+}
@@ -0,0 +1,261 @@
+package pkg
+
+import (
+	"context"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/resolution"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+)
+
+// DefaultClockSkew is how far the verifier's clock may be off from the issuer's when checking nbf and exp
+const DefaultClockSkew = time.Minute
+
+var (
+	// ErrCredentialNotYetValid is returned for a credential whose validFrom (nbf) is still in the future
+	ErrCredentialNotYetValid = errors.New("credential is not yet valid")
+	// ErrCredentialExpired is returned for a credential whose validUntil (exp) has passed
+	ErrCredentialExpired = errors.New("credential has expired")
+	// ErrInvalidSignature is returned when the VP or a VC is not signed by the key it claims
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrAudienceMismatch is returned for a VP addressed to someone other than the verifier
+	ErrAudienceMismatch = errors.New("presentation is not addressed to the verifier")
+)
+
+// VerifyOption configures how a presentation and its credentials are verified
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	clock         func() time.Time
+	skew          time.Duration
+	statusFetcher StatusFetcher
+	trusted       *TrustedIssuerRegistry
+	definition    *exchange.PresentationDefinition
+	replay        *ReplayCache
+}
+
+// WithClock sets the clock credentials' validity windows are checked against; tests use it to fix the time
+func WithClock(clock func() time.Time) VerifyOption {
+	return func(o *verifyOptions) {
+		o.clock = clock
+	}
+}
+
+// WithClockSkew sets the tolerance applied to nbf and exp; defaults to DefaultClockSkew
+func WithClockSkew(skew time.Duration) VerifyOption {
+	return func(o *verifyOptions) {
+		o.skew = skew
+	}
+}
+
+// WithStatusFetcher sets how status list credentials are retrieved; defaults to HTTPStatusFetcher
+func WithStatusFetcher(fetcher StatusFetcher) VerifyOption {
+	return func(o *verifyOptions) {
+		o.statusFetcher = fetcher
+	}
+}
+
+// WithTrustedIssuers makes the verifier accept only credentials from issuers in the registry, and only of the
+// types each issuer is trusted for. Without it any issuer whose signature verifies is accepted.
+func WithTrustedIssuers(registry *TrustedIssuerRegistry) VerifyOption {
+	return func(o *verifyOptions) {
+		o.trusted = registry
+	}
+}
+
+// WithPresentationDefinition makes the verifier evaluate the VP's presentation_submission against the definition
+// it sent in its presentation request
+func WithPresentationDefinition(def exchange.PresentationDefinition) VerifyOption {
+	return func(o *verifyOptions) {
+		o.definition = &def
+	}
+}
+
+// WithReplayCache makes the verifier accept a VP only if it echoes a nonce issued by the cache, before the
+// request carrying it expired, and only once. The nonce is redeemed once every other check passed, so a VP that is
+// turned down leaves it for a corrected one.
+func WithReplayCache(cache *ReplayCache) VerifyOption {
+	return func(o *verifyOptions) {
+		o.replay = cache
+	}
+}
+
+func newVerifyOptions(opts ...VerifyOption) verifyOptions {
+	o := verifyOptions{
+		clock:         time.Now,
+		skew:          DefaultClockSkew,
+		statusFetcher: HTTPStatusFetcher{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// VerifiedCredential is a credential from a presentation whose signature and validity window were checked
+type VerifiedCredential struct {
+	JWT        string
+	Token      jwt.Token
+	Credential *credential.VerifiableCredential
+}
+
+// VerifiedPresentation is a presentation whose signature, audience and credentials were checked
+type VerifiedPresentation struct {
+	// Holder is the DID which signed the presentation and which every credential was issued to
+	Holder       string
+	Token        jwt.Token
+	Presentation *credential.VerifiablePresentation
+	Credentials  []VerifiedCredential
+}
+
+// VerifyPresentation is the verification pipeline run against a Presentation Submission before access is decided.
+// It checks:
+//  1. The VP signature, using the verifier's key, and that the VP is addressed to the verifier
+//  2. That the VP is signed by a key of the holder DID in its iss claim
+//  3. For every VC in the VP, that it is inside its validity window and that its signature matches the issuer's DID
+//  4. For every VC with a credentialStatus, that it is neither revoked nor suspended
+//  5. That every membership VC is linked to an identity VC presented alongside it (ErrIdentityLinkBroken)
+//  6. That every VC was issued to the holder: its credentialSubject.id or IdentityReference.id is the holder DID
+//     (ErrHolderBindingFailed)
+//  7. The presentation definition, if one is configured, and last the VP's nonce, if a replay cache is configured
+//
+// Validity windows are checked against the configured clock rather than the wall clock, so all time checks
+// happen here instead of while parsing the JWTs.
+func VerifyPresentation(verifier jwx.Verifier, r resolution.Resolver, submissionBytes []byte, opts ...VerifyOption) (*VerifiedPresentation, error) {
+	o := newVerifyOptions(opts...)
+	if r == nil {
+		return nil, errors.New("resolver cannot be empty")
+	}
+
+	token := string(submissionBytes)
+	if err := verifier.VerifyJWS(token); err != nil {
+		return nil, errors.Wrapf(ErrInvalidSignature, "VP: %s", err)
+	}
+	_, vpToken, vp, err := credential.ParseVerifiablePresentationFromJWT(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing VP")
+	}
+
+	// make sure the audience matches the verifier
+	audMatch := false
+	for _, aud := range vpToken.Audience() {
+		if aud == verifier.ID || aud == verifier.KID {
+			audMatch = true
+			break
+		}
+	}
+	if !audMatch {
+		return nil, errors.Wrapf(ErrAudienceMismatch, "expected [%s] or [%s], got %s", verifier.ID, verifier.KID, vpToken.Audience())
+	}
+
+	holder := vpToken.Issuer()
+	if err = verifyHolderSignature(r, token, holder); err != nil {
+		return nil, err
+	}
+
+	verified := VerifiedPresentation{Holder: holder, Token: vpToken, Presentation: vp}
+	for i, maybeCred := range vp.VerifiableCredential {
+		credJWT, ok := maybeCred.(string)
+		if !ok {
+			return nil, errors.Errorf("credential %d is not a JWT", i)
+		}
+		vc, err := verifyCredentialJWT(r, credJWT, o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "verifying credential %d", i)
+		}
+		if o.trusted != nil {
+			if err = o.trusted.CheckCredential(vc.Credential); err != nil {
+				return nil, err
+			}
+		}
+		if err = checkCredentialStatus(r, *vc, o); err != nil {
+			return nil, errors.Wrapf(err, "checking status of credential<%s>", vc.Credential.ID)
+		}
+		verified.Credentials = append(verified.Credentials, *vc)
+	}
+	if err = checkIdentityLinks(verified.Credentials); err != nil {
+		return nil, err
+	}
+	if err = checkHolderBinding(holder, verified.Credentials); err != nil {
+		return nil, err
+	}
+	if o.definition != nil {
+		if err = checkPresentationSubmission(*o.definition, vp, verified.Credentials); err != nil {
+			return nil, err
+		}
+	}
+	nonce, _ := vpToken.Get(credential.NonceProperty)
+	nonceStr, _ := nonce.(string)
+	if err = o.redeem(nonceStr); err != nil {
+		return nil, err
+	}
+	return &verified, nil
+}
+
+// redeem redeems the nonce of a presentation with the replay cache, if one is configured. It is the last check
+// of a presentation; Redeem looks the nonce up and removes it under one lock, so of two presentations echoing
+// the same nonce only one is accepted.
+func (o verifyOptions) redeem(nonce string) error {
+	if o.replay == nil {
+		return nil
+	}
+	return o.replay.Redeem(nonce, o.clock())
+}
+
+// verifyCredentialJWT checks a credential's validity window and then its signature against the key in the
+// issuer's DID document matching the kid in the JWT header
+func verifyCredentialJWT(r resolution.Resolver, credJWT string, o verifyOptions) (*VerifiedCredential, error) {
+	headers, token, cred, err := credential.ParseVerifiableCredentialFromJWT(credJWT)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing JWT")
+	}
+	if err = checkValidityWindow(token, o); err != nil {
+		return nil, errors.Wrapf(err, "credential<%s>", token.JwtID())
+	}
+
+	if err = verifyIssuerSignature(r, credJWT, token.Issuer(), headers.KeyID(), token.JwtID()); err != nil {
+		return nil, err
+	}
+	return &VerifiedCredential{JWT: credJWT, Token: token, Credential: cred}, nil
+}
+
+// verifyIssuerSignature checks the signature of credential credID against the key in the issuer's DID document
+// matching the kid in its header
+func verifyIssuerSignature(r resolution.Resolver, token, issuer, issuerKID, credID string) error {
+	if issuerKID == "" {
+		return errors.Errorf("missing kid in header of credential<%s>", credID)
+	}
+	issuerDID, err := r.Resolve(context.Background(), issuer)
+	if err != nil {
+		return errors.Wrapf(err, "resolving issuer DID<%s> of credential<%s>", issuer, credID)
+	}
+	issuerKey, err := did.GetKeyFromVerificationMethod(issuerDID.Document, issuerKID)
+	if err != nil {
+		return errors.Wrapf(err, "getting key to verify credential<%s>", credID)
+	}
+	credVerifier, err := jwx.NewJWXVerifier(issuerDID.ID, issuerKID, issuerKey)
+	if err != nil {
+		return errors.Wrapf(err, "constructing verifier for credential<%s>", credID)
+	}
+	if err = credVerifier.VerifyJWS(token); err != nil {
+		return errors.Wrapf(ErrInvalidSignature, "credential<%s>: %s", credID, err)
+	}
+	return nil
+}
+
+// checkValidityWindow rejects credentials used before their nbf or after their exp, allowing for clock skew
+func checkValidityWindow(token jwt.Token, o verifyOptions) error {
+	now := o.clock()
+	if nbf := token.NotBefore(); !nbf.IsZero() && now.Add(o.skew).Before(nbf) {
+		return errors.Wrapf(ErrCredentialNotYetValid, "valid from %s", nbf.Format(time.RFC3339))
+	}
+	if exp := token.Expiration(); !exp.IsZero() && now.Add(-o.skew).After(exp) {
+		return errors.Wrapf(ErrCredentialExpired, "expired at %s", exp.Format(time.RFC3339))
+	}
+	return nil
+}
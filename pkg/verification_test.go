@@ -0,0 +1,263 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TBD54566975/ssi-sdk/credential"
+	"github.com/TBD54566975/ssi-sdk/credential/exchange"
+	"github.com/TBD54566975/ssi-sdk/crypto"
+	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
+	"github.com/TBD54566975/ssi-sdk/did"
+	"github.com/TBD54566975/ssi-sdk/did/key"
+)
+
+// newTestEntity makes an entity with a did:key DID, which resolves without a network
+func newTestEntity(t *testing.T, name string, opts ...EntityOption) (*Entity, *jwx.Signer) {
+	t.Helper()
+	e, err := NewEntity(name, did.KeyMethod, opts...)
+	if err != nil {
+		t.Fatalf("making entity<%s>: %v", name, err)
+	}
+	signer, err := e.Signer()
+	if err != nil {
+		t.Fatalf("getting signer of entity<%s>: %v", name, err)
+	}
+	return e, signer
+}
+
+// presentTestJWT signs a VP of creds for holder with the key of signer, addressed to audience and echoing nonce.
+// It returns the VP with the verifier VerifyPresentation checks its signature with.
+func presentTestJWT(t *testing.T, signer *jwx.Signer, holder, audience, nonce string, submission *exchange.PresentationSubmission, creds ...string) ([]byte, jwx.Verifier) {
+	t.Helper()
+	vp := credential.VerifiablePresentation{
+		Context: []string{credential.VerifiableCredentialsLinkedDataContext},
+		Type:    []string{credential.VerifiablePresentationType},
+		Holder:  holder,
+	}
+	if submission != nil {
+		vp.PresentationSubmission = *submission
+	}
+	for _, cred := range creds {
+		vp.VerifiableCredential = append(vp.VerifiableCredential, cred)
+	}
+	presentation, err := signPresentationJWT(*signer, audience, nonce, vp, nil)
+	if err != nil {
+		t.Fatalf("signing VP: %v", err)
+	}
+	verifier, err := signer.ToVerifier(audience)
+	if err != nil {
+		t.Fatalf("making VP verifier: %v", err)
+	}
+	return presentation, *verifier
+}
+
+func TestCheckValidityWindow(t *testing.T) {
+	_, issuer := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	validFrom := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	validUntil := validFrom.Add(time.Hour)
+	issued, err := NewIssuer(*issuer).Issue(SingleVCTemplate([]string{"G1"}), student.ID,
+		WithValidFrom(validFrom), WithValidUntil(validUntil))
+	if err != nil {
+		t.Fatalf("issuing credential: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		skew    time.Duration
+		wantErr error
+	}{
+		{name: "not yet valid", now: validFrom.Add(-2 * time.Minute), skew: DefaultClockSkew, wantErr: ErrCredentialNotYetValid},
+		{name: "before validFrom within skew", now: validFrom.Add(-30 * time.Second), skew: DefaultClockSkew},
+		{name: "before validFrom without skew", now: validFrom.Add(-30 * time.Second), wantErr: ErrCredentialNotYetValid},
+		{name: "valid", now: validFrom.Add(30 * time.Minute), skew: DefaultClockSkew},
+		{name: "after validUntil within skew", now: validUntil.Add(30 * time.Second), skew: DefaultClockSkew},
+		{name: "after validUntil without skew", now: validUntil.Add(30 * time.Second), wantErr: ErrCredentialExpired},
+		{name: "expired", now: validUntil.Add(2 * time.Minute), skew: DefaultClockSkew, wantErr: ErrCredentialExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			o := newVerifyOptions(WithClock(func() time.Time { return now }), WithClockSkew(tt.skew))
+			_, err := verifyCredentialJWT(key.Resolver{}, issued.JWT, o)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected a valid credential, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyCredentialJWTTampered(t *testing.T) {
+	_, issuer := newTestEntity(t, "University")
+	_, other := newTestEntity(t, "Other University")
+	_, student := newTestEntity(t, "Student")
+	issued, err := NewIssuer(*issuer).Issue(SingleVCTemplate([]string{"G1"}), student.ID)
+	if err != nil {
+		t.Fatalf("issuing credential: %v", err)
+	}
+	forged, err := NewIssuer(*other).Issue(SingleVCTemplate([]string{"G1"}), student.ID)
+	if err != nil {
+		t.Fatalf("issuing credential: %v", err)
+	}
+
+	if _, err = verifyCredentialJWT(key.Resolver{}, issued.JWT, newVerifyOptions()); err != nil {
+		t.Fatalf("expected a valid credential, got %v", err)
+	}
+	// the credential under the signature of another issuer's credential
+	parts := strings.Split(issued.JWT, ".")
+	tampered := parts[0] + "." + parts[1] + "." + strings.Split(forged.JWT, ".")[2]
+	if _, err = verifyCredentialJWT(key.Resolver{}, tampered, newVerifyOptions()); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestVerifyPresentationReplay(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	cache := NewReplayCache()
+	challenge := cache.NewChallenge(DefaultRequestTTL)
+	presentation, verifier := presentTestJWT(t, student, student.ID, employer.ID, challenge.Nonce, nil, issueTestJWT(t, university, student))
+	untrusted, err := NewTrustedIssuerRegistry()
+	if err != nil {
+		t.Fatalf("making trusted issuer registry: %v", err)
+	}
+
+	// a VP turned down leaves its nonce for a corrected one
+	_, err = VerifyPresentation(verifier, key.Resolver{}, presentation, WithReplayCache(cache), WithTrustedIssuers(untrusted))
+	if !errors.Is(err, ErrIssuerUntrusted) {
+		t.Fatalf("expected %v, got %v", ErrIssuerUntrusted, err)
+	}
+	if _, err = VerifyPresentation(verifier, key.Resolver{}, presentation, WithReplayCache(cache)); err != nil {
+		t.Fatalf("expected the VP to verify, got %v", err)
+	}
+	_, err = VerifyPresentation(verifier, key.Resolver{}, presentation, WithReplayCache(cache))
+	if !errors.Is(err, ErrPresentationReplayed) {
+		t.Fatalf("expected %v, got %v", ErrPresentationReplayed, err)
+	}
+
+	unknown, verifier := presentTestJWT(t, student, student.ID, employer.ID, "unknown", nil, issueTestJWT(t, university, student))
+	_, err = VerifyPresentation(verifier, key.Resolver{}, unknown, WithReplayCache(cache))
+	if !errors.Is(err, ErrPresentationReplayed) {
+		t.Fatalf("expected %v, got %v", ErrPresentationReplayed, err)
+	}
+}
+
+func TestVerifyPresentation(t *testing.T) {
+	_, university := newTestEntity(t, "University")
+	_, student := newTestEntity(t, "Student")
+	_, employer := newTestEntity(t, "Employer")
+	_, other := newTestEntity(t, "Other")
+	now := time.Now().Truncate(time.Second)
+	issue := func(tmpl CredentialTemplate, opts ...IssueOption) *IssuedCredential {
+		t.Helper()
+		// each credential gets its own id, so it gets its own status list entries
+		tmpl.ID = ""
+		issued, err := NewIssuer(*university).Issue(tmpl, student.ID, append([]IssueOption{WithValidFrom(now.Add(-time.Hour))}, opts...)...)
+		if err != nil {
+			t.Fatalf("issuing credential: %v", err)
+		}
+		return issued
+	}
+	valid := issue(SingleVCTemplate([]string{"G1"}))
+	expired := issue(SingleVCTemplate([]string{"G1"}), WithValidUntil(now.Add(-30*time.Minute)))
+	notYetValid := issue(SingleVCTemplate([]string{"G1"}), WithValidFrom(now.Add(time.Hour)))
+	justExpired := issue(SingleVCTemplate([]string{"G1"}), WithValidUntil(now.Add(-30*time.Second)))
+
+	statuses := NewStatusRegistry(*university, "https://university.example/status")
+	withStatus := issue(SingleVCTemplate([]string{"G1"}), WithStatus(statuses))
+	revoked := issue(SingleVCTemplate([]string{"G1"}), WithStatus(statuses))
+	suspended := issue(SingleVCTemplate([]string{"G1"}), WithStatus(statuses))
+	if err := statuses.Revoke(revoked.ID); err != nil {
+		t.Fatalf("revoking credential: %v", err)
+	}
+	if err := statuses.Suspend(suspended.ID); err != nil {
+		t.Fatalf("suspending credential: %v", err)
+	}
+
+	identity := issue(IdentityTemplate(student.ID))
+	reissued := issue(IdentityTemplate(student.ID))
+	membership := issue(MembershipTemplate(student.ID, NewIdentityLink(identity.ID, identity.JWT), "G1"))
+	// the digest of another identity VC under the id of the presented one
+	mislinked := issue(MembershipTemplate(student.ID, NewIdentityLink(identity.ID, reissued.JWT), "G1"))
+
+	trust := func(issuers ...TrustedIssuer) VerifyOption {
+		t.Helper()
+		registry, err := NewTrustedIssuerRegistry(issuers...)
+		if err != nil {
+			t.Fatalf("making trusted issuer registry: %v", err)
+		}
+		return WithTrustedIssuers(registry)
+	}
+
+	def := exchange.PresentationDefinition{ID: "test", InputDescriptors: []exchange.InputDescriptor{{ID: "id-1"}}}
+	esDef := def
+	esDef.Format = &exchange.ClaimFormat{JWTVC: &exchange.JWTType{Alg: []crypto.SignatureAlgorithm{crypto.ES256}}}
+	submit := func(definitionID, descriptorID, format string) *exchange.PresentationSubmission {
+		return &exchange.PresentationSubmission{
+			ID:            "submission",
+			DefinitionID:  definitionID,
+			DescriptorMap: []exchange.SubmissionDescriptor{{ID: descriptorID, Format: format, Path: "$.verifiableCredential[0]"}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		signer     *jwx.Signer
+		holder     string
+		creds      []string
+		submission *exchange.PresentationSubmission
+		opts       []VerifyOption
+		wantErr    error
+	}{
+		{name: "valid", creds: []string{valid.JWT}},
+		{name: "expired credential", creds: []string{valid.JWT, expired.JWT}, wantErr: ErrCredentialExpired},
+		{name: "credential not yet valid", creds: []string{notYetValid.JWT}, wantErr: ErrCredentialNotYetValid},
+		{name: "expired within clock skew", creds: []string{justExpired.JWT}},
+		{name: "expired without clock skew", creds: []string{justExpired.JWT}, opts: []VerifyOption{WithClockSkew(0)}, wantErr: ErrCredentialExpired},
+		{name: "status bits clear", creds: []string{withStatus.JWT}, opts: []VerifyOption{WithStatusFetcher(statuses)}},
+		{name: "revoked", creds: []string{withStatus.JWT, revoked.JWT}, opts: []VerifyOption{WithStatusFetcher(statuses)}, wantErr: ErrCredentialRevoked},
+		{name: "suspended", creds: []string{suspended.JWT}, opts: []VerifyOption{WithStatusFetcher(statuses)}, wantErr: ErrCredentialSuspended},
+		{name: "membership linked to the identity", creds: []string{identity.JWT, membership.JWT}},
+		{name: "membership without its identity", creds: []string{reissued.JWT, membership.JWT}, wantErr: ErrIdentityLinkBroken},
+		{name: "identity link digest mismatch", creds: []string{identity.JWT, mislinked.JWT}, wantErr: ErrIdentityLinkBroken},
+		{name: "VP of another DID with the student's VC", signer: other, creds: []string{valid.JWT}, wantErr: ErrHolderBindingFailed},
+		{name: "VP as the student signed by another DID", signer: other, holder: student.ID, creds: []string{valid.JWT}, wantErr: ErrHolderBindingFailed},
+		{name: "trusted issuer", creds: []string{valid.JWT}, opts: []VerifyOption{trust(TrustedIssuer{DID: university.ID, Types: []string{"AlumniCredential"}})}},
+		{name: "untrusted issuer", creds: []string{valid.JWT}, opts: []VerifyOption{trust(TrustedIssuer{DID: other.ID, Types: []string{AnyCredentialType}})}, wantErr: ErrIssuerUntrusted},
+		{name: "issuer untrusted for the type", creds: []string{identity.JWT, membership.JWT}, opts: []VerifyOption{trust(TrustedIssuer{DID: university.ID, Types: []string{"AlumniCredential"}})}, wantErr: ErrIssuerUntrusted},
+		{name: "submission answering the definition", creds: []string{valid.JWT}, submission: submit("test", "id-1", "jwt_vc"), opts: []VerifyOption{WithPresentationDefinition(def)}},
+		{name: "no submission", creds: []string{valid.JWT}, opts: []VerifyOption{WithPresentationDefinition(def)}, wantErr: ErrSubmissionMismatch},
+		{name: "submission for another definition", creds: []string{valid.JWT}, submission: submit("other", "id-1", "jwt_vc"), opts: []VerifyOption{WithPresentationDefinition(def)}, wantErr: ErrSubmissionMismatch},
+		{name: "descriptor mismatch", creds: []string{valid.JWT}, submission: submit("test", "id-2", "jwt_vc"), opts: []VerifyOption{WithPresentationDefinition(def)}, wantErr: ErrSubmissionMismatch},
+		{name: "format mismatch", creds: []string{valid.JWT}, submission: submit("test", "id-1", "ldp_vc"), opts: []VerifyOption{WithPresentationDefinition(esDef)}, wantErr: ErrSubmissionMismatch},
+		{name: "alg not accepted", creds: []string{valid.JWT}, submission: submit("test", "id-1", "jwt_vc"), opts: []VerifyOption{WithPresentationDefinition(esDef)}, wantErr: ErrSubmissionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, holder := student, student.ID
+			if tt.signer != nil {
+				signer, holder = tt.signer, tt.signer.ID
+			}
+			if tt.holder != "" {
+				holder = tt.holder
+			}
+			presentation, verifier := presentTestJWT(t, signer, holder, employer.ID, "nonce", tt.submission, tt.creds...)
+			opts := append([]VerifyOption{WithClock(func() time.Time { return now })}, tt.opts...)
+			_, err := VerifyPresentation(verifier, key.Resolver{}, presentation, opts...)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected the VP to verify, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -1,63 +1,87 @@
 package pkg
 
 import (
-	"context"
-	"reflect"
-
 	"github.com/TBD54566975/ssi-sdk/credential"
 	"github.com/TBD54566975/ssi-sdk/crypto/jwx"
 	"github.com/TBD54566975/ssi-sdk/did/resolution"
 	"github.com/pkg/errors"
 )
 
-// ValidateAccess is a very simple validation process against a Presentation Submission
+// ErrAccessDenied is the error of an AccessDecision that does not allow access
+var ErrAccessDenied = errors.New("access denied")
+
+// ValidateAccess is the verifier's decision on a Presentation Submission
 // It checks:
-// 1. That the VP is valid
-// 2. All VCs in the VP are valid
-// 3. That the VC was issued by a trusted entity (implied by the presentation, according to the Presentation Definition)
-func ValidateAccess(verifier jwx.Verifier, r resolution.Resolver, submissionBytes []byte) error {
-	m := map[string]any{"value": "Teaching Assistant",
-	"lang": "en",
-} 
-	_, _, vp, err := credential.VerifyVerifiablePresentationJWT(context.Background(), verifier, r, string(submissionBytes))
+// 1. That the VP and all VCs in it pass VerifyPresentation (signatures, validity windows, status, identity links)
+// 2. That the VP is well-formed
+// 3. That the presented VCs, in any number and order, satisfy every requirement of the access policy
+// Access is only allowed when every check passes; otherwise the decision lists why it was denied.
+func ValidateAccess(verifier jwx.Verifier, r resolution.Resolver, submissionBytes []byte, policy AccessPolicy, opts ...VerifyOption) AccessDecision {
+	verified, err := VerifyPresentation(verifier, r, submissionBytes, opts...)
 	if err != nil {
-		return errors.Wrap(err, "validating VP signature")
+		return deniedBy(err)
+	}
+	if err = verified.Presentation.IsValid(); err != nil {
+		return deniedBy(errors.Wrap(err, "validating VP"))
 	}
+	return evaluateVerified(verified, policy)
+}
+
+// ValidateSDJWTAccess is ValidateAccess for an SD-JWT VC presented with PresentSDJWT. The presentation must pass
+// VerifySDJWTPresentation for the verifier's DID as audience, and the disclosed claims must satisfy the policy.
+func ValidateSDJWTAccess(audience string, r resolution.Resolver, presentation []byte, policy AccessPolicy, opts ...VerifyOption) AccessDecision {
+	return validateAddressed(VerifySDJWTPresentation, audience, r, presentation, policy, opts...)
+}
+
+// ValidateBBSAccess is ValidateAccess for a proof derived from a BBS credential with PresentBBS. The presentation
+// must pass VerifyBBSPresentation for the verifier's DID as audience, and the revealed claims must satisfy the policy.
+func ValidateBBSAccess(audience string, r resolution.Resolver, presentation []byte, policy AccessPolicy, opts ...VerifyOption) AccessDecision {
+	return validateAddressed(VerifyBBSPresentation, audience, r, presentation, policy, opts...)
+}
 
-	if err = vp.IsValid(); err != nil {
-		return errors.Wrap(err, "validating VP")
+// ValidateGroupAccess is ValidateAccess for a submission made with RespondWithGroupProofs. After the VP passes
+// VerifyPresentation, every group membership proof must lead to the root of the commitment VC it refers to
+// (ErrGroupProofInvalid); the policy then sees the proven groups as the roles of that VC.
+func ValidateGroupAccess(verifier jwx.Verifier, r resolution.Resolver, submissionBytes []byte, policy AccessPolicy, opts ...VerifyOption) AccessDecision {
+	verified, err := VerifyPresentation(verifier, r, submissionBytes, opts...)
+	if err != nil {
+		return deniedBy(err)
+	}
+	if err = verified.Presentation.IsValid(); err != nil {
+		return deniedBy(errors.Wrap(err, "validating VP"))
 	}
-	if len(vp.VerifiableCredential) < 2 {
-		// Case 1 - parse VC and get all roles and check  if 'Teaching assistant role' exists
-		x, _ := vp.VerifiableCredential[0].(string)
-		_, _, token, _ := credential.ParseVerifiableCredentialFromJWT(x)
-		for _, obj :=  range(token.CredentialSubject){
-			y, ok := obj.([]interface{})
-			if ok {
-             for _, elem := range(y) {
-				eq := reflect.DeepEqual(elem, m)
-				if eq {
-					return nil // we found the required role from the list
-				}
-			 }
-			return errors.Wrap(err, "validating VP")
-			}
-		}
-		return nil
+	creds, err := provenGroups(verified)
+	if err != nil {
+		return deniedBy(err)
+	}
+	return policy.Evaluate(creds)
+}
+
+// ValidateDataIntegrityAccess is ValidateAccess for a VP made with BuildDataIntegritySubmission. The presentation
+// must pass VerifyDataIntegrityPresentation for the verifier's DID as audience, and its credentials must satisfy
+// the policy.
+func ValidateDataIntegrityAccess(audience string, r resolution.Resolver, presentation []byte, policy AccessPolicy, opts ...VerifyOption) AccessDecision {
+	return validateAddressed(VerifyDataIntegrityPresentation, audience, r, presentation, policy, opts...)
+}
+
+// addressedVerifier verifies a presentation addressed to audience, such as VerifySDJWTPresentation
+type addressedVerifier func(r resolution.Resolver, presentation []byte, audience string, opts ...VerifyOption) (*VerifiedPresentation, error)
+
+// validateAddressed is the decision on a presentation checked with verify: denied if it does not verify, otherwise
+// the policy's decision on its credentials
+func validateAddressed(verify addressedVerifier, audience string, r resolution.Resolver, presentation []byte, policy AccessPolicy, opts ...VerifyOption) AccessDecision {
+	verified, err := verify(r, presentation, audience, opts...)
+	if err != nil {
+		return deniedBy(err)
 	}
-	// case 2 - parse the VC and get the one role in the membership VC
-	x, _ := vp.VerifiableCredential[1].(string)
-	_, _, token, _ := credential.ParseVerifiableCredentialFromJWT(x)
-	for _, obj :=  range(token.CredentialSubject){
-		y, ok := obj.(map[string]interface{})
-		if ok {
-			z, _ := y["roles"].([]interface{})
-			eq := reflect.DeepEqual(z[0],m)
-				if eq {
-					return nil // we found the required role from the list
-				}
-		    return errors.Wrap(err, "validating VP")
-		}
+	return evaluateVerified(verified, policy)
+}
+
+// evaluateVerified is the policy's decision on the credentials of a verified presentation
+func evaluateVerified(verified *VerifiedPresentation, policy AccessPolicy) AccessDecision {
+	creds := make([]*credential.VerifiableCredential, 0, len(verified.Credentials))
+	for _, vc := range verified.Credentials {
+		creds = append(creds, vc.Credential)
 	}
-	return errors.Wrap(err, "validating VP")
+	return policy.Evaluate(creds)
 }